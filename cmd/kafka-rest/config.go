@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// config is the config file with named connection profiles, e.g.
+	//
+	//	{
+	//	  "current": "dev",
+	//	  "profiles": {
+	//	    "dev": {"url": "http://localhost:8082", "api_version": "v2"},
+	//	    "prod": {"url": "https://rest.example.com", "username": "ops", "password": "secret", "group": "ops-cli", "output": "json"}
+	//	  }
+	//	}
+	config struct {
+		Current  string             `json:"current"`
+		Profiles map[string]profile `json:"profiles"`
+	}
+
+	// profile are the connection settings, empty fields are left to defaults.
+	profile struct {
+		URL        string `json:"url"`
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+		APIVersion string `json:"api_version"`
+		Timeout    string `json:"timeout"`
+		Format     string `json:"format"`
+		Group      string `json:"group"`
+		Output     string `json:"output"`
+	}
+)
+
+// defaultConfigPath returns $KAFKA_REST_CONFIG, or kafka-rest/config.json in the user config directory.
+func defaultConfigPath() string {
+	if path, ok := os.LookupEnv("KAFKA_REST_CONFIG"); ok {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "kafka-rest", "config.json")
+}
+
+// loadProfile reads the named profile, or the current one if name is empty, from the config file.
+// A missing config file yields an empty profile unless a profile is named.
+func loadProfile(path, name string) (profile, error) {
+	b, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err) && name == "":
+		return profile{}, nil
+	case err != nil:
+		return profile{}, errors.Wrap(err, "Error: read config")
+	}
+
+	var cfg config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return profile{}, errors.Wrap(err, "Error: parse config "+path)
+	}
+
+	if name == "" {
+		name = cfg.Current
+	}
+	if name == "" {
+		return profile{}, nil
+	}
+
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return profile{}, errors.Errorf("Error: no profile %q in config %v", name, path)
+	}
+	return p, nil
+}
+
+// applyEnv overrides the profile with the KAFKA_REST_* environment variables which are set.
+func (p *profile) applyEnv() {
+	for env, field := range map[string]*string{
+		"KAFKA_REST_URL":         &p.URL,
+		"KAFKA_REST_USERNAME":    &p.Username,
+		"KAFKA_REST_PASSWORD":    &p.Password,
+		"KAFKA_REST_API_VERSION": &p.APIVersion,
+		"KAFKA_REST_TIMEOUT":     &p.Timeout,
+		"KAFKA_REST_FORMAT":      &p.Format,
+		"KAFKA_REST_GROUP":       &p.Group,
+		"KAFKA_REST_OUTPUT":      &p.Output,
+	} {
+		if v, ok := os.LookupEnv(env); ok {
+			*field = v
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strconv"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/pkg/errors"
+)
+
+func runConsume(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("consume", flag.ExitOnError)
+	format := fs.String("format", c.profile.Format, "embedded format binary, json or avro")
+	group := fs.String("group", c.profile.Group, "consumer group, default to a temporary one")
+	fromBeginning := fs.Bool("from-beginning", false, "consume from the oldest offset if the group has no committed offset")
+	keySeparator := fs.String("key-separator", "", "print keys followed by separator before values, values only if empty, table output only")
+	maxMessages := fs.Int("max", 0, "exit after max messages, no limit if 0")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return errors.New("Error: consume requires a topic")
+	}
+
+	if *group == "" {
+		*group = "kafka-rest-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	k := c.k
+	if err := k.SetOption(formatOption(K.Format(*format))); err != nil {
+		return err
+	}
+
+	cr := K.ConsumerRequest{Format: k.Format, Offset: K.Latest}
+	switch {
+	case k.Version == K.V1 && *fromBeginning:
+		cr.Offset = K.Smallest
+	case k.Version == K.V1:
+		cr.Offset = K.Largest
+	case *fromBeginning:
+		cr.Offset = K.Earliest
+	}
+
+	mc := k.NewConsumers(*group).NewManagedConsumer(cr)
+	mc.Topics = fs.Args()
+	// only the printed messages are committed, the next consume of the group starts after them
+	mc.MaxMessages = *maxMessages
+
+	consumed := 0
+	err := mc.Run(ctx, func(_ context.Context, messages []K.Message) error {
+		for _, m := range messages {
+			if err := printMessage(c.out, k.Format, m, *keySeparator); err != nil {
+				return err
+			}
+			consumed++
+		}
+		return nil
+	})
+
+	// interrupted, the consumer instance is deleted
+	if err == context.Canceled {
+		err = nil
+	}
+
+	fmt.Fprintf(c.stderr, "consumed %d messages\n", consumed)
+	return err
+}
+
+// record is a consumed message with its key and value decoded.
+type record struct {
+	Topic     string      `json:"topic"`
+	Partition int         `json:"partition"`
+	Offset    int64       `json:"offset"`
+	Key       interface{} `json:"key"`
+	Value     interface{} `json:"value"`
+}
+
+// printMessage prints a line per message for table output, the decoded record otherwise.
+func printMessage(out *printer, format K.Format, m K.Message, keySeparator string) error {
+	if out.format == tableOutput {
+		line, err := formatMessage(format, m, keySeparator)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(out.w, line)
+		return err
+	}
+
+	key, err := recordField(format, m.Key)
+	if err != nil {
+		return err
+	}
+	value, err := recordField(format, m.Value)
+	if err != nil {
+		return err
+	}
+	return out.print(record{Topic: m.Topic, Partition: m.Partition, Offset: m.Offset, Key: key, Value: value})
+}
+
+func formatMessage(format K.Format, m K.Message, keySeparator string) (string, error) {
+	value, err := decodeField(format, m.Value)
+	if err != nil {
+		return "", err
+	}
+
+	if keySeparator == "" {
+		return value, nil
+	}
+
+	key, err := decodeField(format, m.Key)
+	if err != nil {
+		return "", err
+	}
+	return key + keySeparator + value, nil
+}
+
+// recordField decodes a binary key or value to a string, JSON is kept as is so that it is not quoted.
+func recordField(format K.Format, raw json.RawMessage) (interface{}, error) {
+	if format == K.Binary || len(raw) == 0 {
+		return decodeField(format, raw)
+	}
+	return raw, nil
+}
+
+// decodeField decodes a key or value in the embedded format, base64 for binary, JSON as is otherwise.
+func decodeField(format K.Format, raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+
+	if format != K.Binary {
+		return string(raw), nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
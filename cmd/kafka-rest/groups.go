@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/pkg/errors"
+)
+
+func runGroups(ctx context.Context, c *cli, args []string) error {
+	group, topics, err := groupArgs("groups", args)
+	if err != nil {
+		return err
+	}
+
+	return withGroupInstance(ctx, c.k, group, topics, func(cs *K.Consumers, consumerName string, partitions []K.ConsumerPartitions) error {
+		offsets, err := cs.OffsetsContext(ctx, &K.ConsumerOffsetsPartitions{Partitions: partitions}, consumerName)
+		if err != nil {
+			return err
+		}
+		return c.out.print(offsets)
+	})
+}
+
+func runLag(ctx context.Context, c *cli, args []string) error {
+	group, topics, err := groupArgs("lag", args)
+	if err != nil {
+		return err
+	}
+
+	return withGroupInstance(ctx, c.k, group, topics, func(cs *K.Consumers, consumerName string, _ []K.ConsumerPartitions) error {
+		lag, err := cs.Lag(ctx, consumerName)
+		if err != nil {
+			return err
+		}
+		return c.out.print(lag)
+	})
+}
+
+func groupArgs(name string, args []string) (string, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		return "", nil, errors.Errorf("Error: %s requires a group and topics", name)
+	}
+	return fs.Arg(0), fs.Args()[1:], nil
+}
+
+// withGroupInstance creates a temporary consumer instance in the group, manually assigned the partitions of topics
+// so that the group does not rebalance, calls fn with it and deletes it. The REST API has no endpoint to read
+// the committed offsets of a group without a consumer instance.
+func withGroupInstance(ctx context.Context, k *K.Kafka, group string, topics []string, fn func(*K.Consumers, string, []K.ConsumerPartitions) error) error {
+	if k.Version != K.V2 {
+		return errors.New("Error: requires API v2")
+	}
+
+	var partitions []K.ConsumerPartitions
+	ps := k.NewTopics().NewPartitions()
+	for _, topic := range topics {
+		pss, err := ps.PartitionsContext(ctx, topic)
+		if err != nil {
+			return err
+		}
+		for _, p := range pss {
+			partitions = append(partitions, K.ConsumerPartitions{Topic: topic, Partition: p.Partition})
+		}
+	}
+
+	cs := k.NewConsumers(group)
+	ci, err := cs.NewConsumerContext(ctx, &K.ConsumerRequest{Format: k.Format, Offset: K.Latest, AutoCommit: "false"})
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		cs.DeleteConsumerContext(ctx, ci.ConsumerName)
+	}()
+
+	err = cs.AssignContext(ctx, &K.ConsumerOffsetsPartitions{Partitions: partitions}, ci.ConsumerName)
+	if err != nil {
+		return err
+	}
+
+	return fn(cs, ci.ConsumerName, partitions)
+}
@@ -0,0 +1,231 @@
+// Command kafka-rest is a command line tool for Kafka REST proxies, built on package kafka.
+//
+// Usage:
+//
+//	kafka-rest [flags] <command> [command flags] [args]
+//
+// Commands:
+//
+//	brokers                        list brokers
+//	topics list                    list topic names
+//	topics describe <topic>...     describe topics with their partitions and configs
+//	partitions <topic>             list partitions of a topic
+//	produce <topic>                produce lines read from stdin
+//	consume <topic>...             consume with a temporary consumer instance until interrupted
+//	groups <group> <topic>...      show committed offsets of a consumer group (API v2)
+//	lag <group> <topic>...         show lag of a consumer group (API v2)
+//
+// Output is printed as a table by default, or as json, jsonl, yaml or a Go template with -output.
+//
+// Connection settings are read from the named profile, or the current one, of the config file
+// $KAFKA_REST_CONFIG or kafka-rest/config.json in the user config directory, overridden by
+// KAFKA_REST_URL, KAFKA_REST_USERNAME, KAFKA_REST_PASSWORD, KAFKA_REST_API_VERSION, KAFKA_REST_TIMEOUT,
+// KAFKA_REST_FORMAT, KAFKA_REST_GROUP and KAFKA_REST_OUTPUT, overridden by flags.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/pkg/errors"
+)
+
+type (
+	command struct {
+		usage string
+		run   func(ctx context.Context, c *cli, args []string) error
+	}
+
+	// cli is what commands run with, the client, resolved settings, output printer, input and diagnostics.
+	cli struct {
+		k       *K.Kafka
+		profile profile
+		out     *printer
+		stdin   io.Reader
+		stderr  io.Writer
+	}
+)
+
+var commands = map[string]command{
+	"brokers":    {"brokers", runBrokers},
+	"topics":     {"topics list | topics describe <topic>...", runTopics},
+	"partitions": {"partitions <topic>", runPartitions},
+	"produce":    {"produce [flags] <topic>", runProduce},
+	"consume":    {"consume [flags] <topic>...", runConsume},
+	"groups":     {"groups <group> <topic>...", runGroups},
+	"lag":        {"lag <group> <topic>...", runLag},
+}
+
+func main() {
+	fs := flag.NewFlagSet("kafka-rest", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfigPath(), "config file with named profiles (env KAFKA_REST_CONFIG)")
+	profileName := fs.String("profile", os.Getenv("KAFKA_REST_PROFILE"), "profile to use, default to the current one of the config file (env KAFKA_REST_PROFILE)")
+	flags := profile{}
+	fs.StringVar(&flags.URL, "url", K.Defaults.URL, "REST proxy URL")
+	fs.StringVar(&flags.Username, "username", "", "basic auth username")
+	fs.StringVar(&flags.Password, "password", "", "basic auth password")
+	fs.StringVar(&flags.APIVersion, "api-version", string(K.Defaults.Version), "REST API version v1 or v2")
+	fs.StringVar(&flags.Timeout, "timeout", K.Defaults.Timeout.String(), "request timeout")
+	fs.StringVar(&flags.Output, "output", tableOutput, "output table, json, jsonl, yaml or template")
+	fs.StringVar(&flags.Output, "o", tableOutput, "shorthand for -output")
+	tmpl := fs.String("template", "", "Go template for template output, fields by JSON name, e.g. {{.name}}")
+	fs.Usage = func() { usage(fs) }
+	fs.Parse(os.Args[1:])
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "kafka-rest: unknown command %q\n", fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	p, err := resolveProfile(fs, *configPath, *profileName, flags)
+	if err != nil {
+		fatal(err)
+	}
+
+	c, err := newCLI(p, *tmpl)
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := cmd.run(ctx, c, fs.Args()[1:]); err != nil {
+		fatal(err)
+	}
+}
+
+// resolveProfile merges the settings, flags set on the command line over env over profile over flag defaults.
+func resolveProfile(fs *flag.FlagSet, configPath, profileName string, flags profile) (profile, error) {
+	p, err := loadProfile(configPath, profileName)
+	if err != nil {
+		return p, err
+	}
+	p.applyEnv()
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for _, f := range []struct {
+		names    []string
+		value    string
+		resolved *string
+	}{
+		{[]string{"url"}, flags.URL, &p.URL},
+		{[]string{"username"}, flags.Username, &p.Username},
+		{[]string{"password"}, flags.Password, &p.Password},
+		{[]string{"api-version"}, flags.APIVersion, &p.APIVersion},
+		{[]string{"timeout"}, flags.Timeout, &p.Timeout},
+		{[]string{"output", "o"}, flags.Output, &p.Output},
+	} {
+		explicit := false
+		for _, name := range f.names {
+			explicit = explicit || set[name]
+		}
+		if explicit || *f.resolved == "" {
+			*f.resolved = f.value
+		}
+	}
+
+	if p.Format == "" {
+		p.Format = string(K.Binary)
+	}
+	return p, nil
+}
+
+func newCLI(p profile, tmpl string) (*cli, error) {
+	timeout, err := time.ParseDuration(p.Timeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error: invalid timeout")
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error: invalid URL")
+	}
+	// net/http sends basic auth for the userinfo of request URLs
+	if p.Username != "" {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+
+	k, err := K.New(K.SetURL(u.String()), K.SetTimeout(timeout), versionOption(K.Version(p.APIVersion)))
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := newPrinter(os.Stdout, p.Output, tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &cli{k: k, profile: p, out: out, stdin: os.Stdin, stderr: os.Stderr}, nil
+}
+
+func usage(fs *flag.FlagSet) {
+	fmt.Fprintln(os.Stderr, "usage: kafka-rest [flags] <command> [command flags] [args]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintln(os.Stderr, "  "+commands[name].usage)
+	}
+
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "flags:")
+	fs.PrintDefaults()
+}
+
+func versionOption(version K.Version) func(*K.Kafka) error {
+	return func(k *K.Kafka) error {
+		switch version {
+		case K.V1, K.V2:
+			k.Version = version
+			return nil
+		default:
+			return errors.Errorf("Error: unknown API version %q", version)
+		}
+	}
+}
+
+// formatOption sets Accept and Content-Type to the embedded format media type of the API version.
+func formatOption(format K.Format) func(*K.Kafka) error {
+	return func(k *K.Kafka) error {
+		switch format {
+		case K.Binary, K.JSON, K.Avro:
+		default:
+			return errors.Errorf("Error: unknown format %q", format)
+		}
+
+		k.Format = format
+		mediaType := fmt.Sprintf("application/vnd.kafka.%s.%s+json", format, k.Version)
+		k.Accept = mediaType + ", " + K.Defaults.Accept
+		k.ContentType = mediaType
+		return nil
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "kafka-rest:", err)
+	os.Exit(1)
+}
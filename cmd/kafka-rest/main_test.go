@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/andy2046/kafka-rest-go/kafkatest"
+)
+
+func TestParseRecord(t *testing.T) {
+	for _, tc := range []struct {
+		format       K.Format
+		line         string
+		keySeparator string
+		key, value   string
+		err          bool
+	}{
+		{K.Binary, "v", "", "", `"dg=="`, false},
+		{K.Binary, "k:v:w", ":", `"aw=="`, `"djp3"`, false},
+		{K.Binary, "k::v", "::", `"aw=="`, `"dg=="`, false},
+		{K.Binary, ":v", ":", `""`, `"dg=="`, false},
+		{K.Binary, "v", ":", "", "", true},
+		{K.JSON, `{"a":1}`, "", "", `{"a":1}`, false},
+		{K.JSON, `"k"|[1,2]`, "|", `"k"`, `[1,2]`, false},
+		{K.JSON, `k|1`, "|", "", "", true},
+		{K.JSON, `{"a":`, "", "", "", true},
+	} {
+		record, err := parseRecord(tc.format, tc.line, tc.keySeparator)
+		if tc.err {
+			if err == nil {
+				t.Errorf("Expected error for %v %q got %+v", tc.format, tc.line, record)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected no error for %v %q got %v", tc.format, tc.line, err)
+			continue
+		}
+		if string(record.Key) != tc.key || string(record.Value) != tc.value {
+			t.Errorf("Expected %s %s for %v %q got %s %s", tc.key, tc.value, tc.format, tc.line, record.Key, record.Value)
+		}
+	}
+}
+
+func TestDecodeField(t *testing.T) {
+	for _, tc := range []struct {
+		format K.Format
+		raw    string
+		s      string
+		err    bool
+	}{
+		{K.Binary, `"aGVsbG8="`, "hello", false},
+		{K.Binary, `null`, "", false},
+		{K.Binary, ``, "", false},
+		{K.Binary, `"not base64!"`, "", true},
+		{K.Binary, `1`, "", true},
+		{K.JSON, `{"a":1}`, `{"a":1}`, false},
+		{K.Avro, `"s"`, `"s"`, false},
+	} {
+		s, err := decodeField(tc.format, json.RawMessage(tc.raw))
+		if tc.err != (err != nil) || s != tc.s {
+			t.Errorf("Expected %q error %v for %v %s got %q %v", tc.s, tc.err, tc.format, tc.raw, s, err)
+		}
+	}
+
+	// binary keys and values round trip
+	for _, s := range []string{"", "a", "ünïcode\ttab", "\x00\xff"} {
+		raw, err := encodeField(K.Binary, s)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if decoded, err := decodeField(K.Binary, raw); err != nil || decoded != s {
+			t.Errorf("Expected %q got %q %v", s, decoded, err)
+		}
+	}
+}
+
+func TestProduceConsume(t *testing.T) {
+	s, _ := kafkatest.NewServer()
+	defer s.Close()
+	s.CreateTopic("t", 1)
+
+	newTestCLI := func(stdin string) (*cli, *bytes.Buffer) {
+		k, _ := s.Client(K.V2Version)
+		var out bytes.Buffer
+		p, _ := newPrinter(&out, tableOutput, "")
+		return &cli{k: k, profile: profile{Format: string(K.Binary)}, out: p, stdin: strings.NewReader(stdin), stderr: io.Discard}, &out
+	}
+	ctx := context.Background()
+
+	c, _ := newTestCLI("k1|v1\n\nk2|v2\nk3|v3\n")
+	if err := runProduce(ctx, c, []string{"-key-separator", "|", "-batch", "2", "t"}); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if messages, _ := s.Messages("t", 0); len(messages) != 3 {
+		t.Fatalf("Expected 3 records produced got %v", len(messages))
+	}
+
+	// the batch of 3 messages is cut short, only the printed ones are committed
+	c, out := newTestCLI("")
+	if err := runConsume(ctx, c, []string{"-group", "g", "-from-beginning", "-max", "2", "-key-separator", "=", "t"}); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if out.String() != "k1=v1\nk2=v2\n" {
+		t.Errorf("Expected 2 messages printed got %q", out.String())
+	}
+	if offset, ok := s.CommittedOffset("g", "t", 0); !ok || offset != 2 {
+		t.Errorf("Expected offset 2 committed got %v %v", offset, ok)
+	}
+
+	c, out = newTestCLI("")
+	if err := runConsume(ctx, c, []string{"-group", "g", "-max", "1", "t"}); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if out.String() != "v3\n" {
+		t.Errorf("Expected next unprinted message got %q", out.String())
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	s, _ := kafkatest.NewServer()
+	defer s.Close()
+	s.CreateTopic("t", 1)
+	k, _ := s.Client(K.V2Version)
+	p, _ := newPrinter(io.Discard, tableOutput, "")
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		run   func(context.Context, *cli, []string) error
+		args  []string
+		stdin string
+	}{
+		{runProduce, []string{}, ""},
+		{runProduce, []string{"-batch", "0", "t"}, ""},
+		{runProduce, []string{"-format", "xml", "t"}, ""},
+		{runProduce, []string{"-format", "json", "t"}, "not json\n"},
+		{runProduce, []string{"-key-separator", "|", "t"}, "no separator\n"},
+		{runProduce, []string{"missing"}, "v\n"},
+		{runConsume, []string{}, ""},
+		{runGroups, []string{"g"}, ""},
+		{runPartitions, []string{}, ""},
+	} {
+		c := &cli{k: k, profile: profile{Format: string(K.Binary)}, out: p, stdin: strings.NewReader(tc.stdin), stderr: io.Discard}
+		if err := tc.run(ctx, c, tc.args); err == nil {
+			t.Errorf("Expected error for %v", tc.args)
+		}
+	}
+}
+
+func TestYAMLOutput(t *testing.T) {
+	var out bytes.Buffer
+	p, _ := newPrinter(&out, yamlOutput, "")
+	v := map[string]interface{}{
+		"name":   "a: b",
+		"list":   []interface{}{"- x", "? y", "&z", "*z", "!tag", "# c", "yes", "No", "null", "~", "1e3", "0x1f", "a\nb", 1, true, nil},
+		"yes":    map[string]interface{}{},
+		"a key":  []interface{}{},
+		"1":      "",
+		"nested": []interface{}{map[string]interface{}{"k": "v", "n": 2}},
+	}
+	if err := p.print(v); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	expected := `---
+"1": ""
+"a key": []
+list:
+  - "- x"
+  - "? y"
+  - "&z"
+  - "*z"
+  - "!tag"
+  - "# c"
+  - "yes"
+  - "No"
+  - "null"
+  - "~"
+  - "1e3"
+  - "0x1f"
+  - "a\nb"
+  - 1
+  - true
+  - null
+name: "a: b"
+nested:
+  - k: "v"
+    "n": 2
+"yes": {}
+`
+	if out.String() != expected {
+		t.Errorf("Expected\n%v\ngot\n%v", expected, out.String())
+	}
+}
+
+func TestResolveProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	os.WriteFile(path, []byte(`{"current":"dev","profiles":{
+		"dev":{"url":"http://dev:8082","username":"dev","timeout":"5s","group":"dev-cli"},
+		"prod":{"url":"https://prod","api_version":"v3"}}}`), 0600)
+
+	if _, err := loadProfile(path, "missing"); err == nil {
+		t.Error("Expected error for missing profile")
+	}
+	if _, err := loadProfile(filepath.Join(t.TempDir(), "none.json"), "dev"); err == nil {
+		t.Error("Expected error for named profile without config file")
+	}
+	if p, err := loadProfile(filepath.Join(t.TempDir(), "none.json"), ""); err != nil || p != (profile{}) {
+		t.Errorf("Expected empty profile without config file got %+v %v", p, err)
+	}
+	if p, _ := loadProfile(path, "prod"); p.APIVersion != "v3" {
+		t.Errorf("Expected prod profile got %+v", p)
+	}
+
+	resolve := func(args ...string) profile {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		var flags profile
+		fs.StringVar(&flags.URL, "url", "http://localhost:8082", "")
+		fs.StringVar(&flags.Username, "username", "", "")
+		fs.StringVar(&flags.APIVersion, "api-version", "v2", "")
+		fs.StringVar(&flags.Timeout, "timeout", "30s", "")
+		fs.StringVar(&flags.Output, "output", "table", "")
+		fs.StringVar(&flags.Output, "o", "table", "")
+		if err := fs.Parse(args); err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		p, err := resolveProfile(fs, path, "", flags)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		return p
+	}
+
+	// profile over flag defaults
+	p := resolve()
+	expected := profile{URL: "http://dev:8082", Username: "dev", APIVersion: "v2", Timeout: "5s",
+		Format: "binary", Group: "dev-cli", Output: "table"}
+	if p != expected {
+		t.Errorf("Expected %+v got %+v", expected, p)
+	}
+
+	// env over profile
+	t.Setenv("KAFKA_REST_URL", "http://env:8082")
+	t.Setenv("KAFKA_REST_GROUP", "env-cli")
+	t.Setenv("KAFKA_REST_OUTPUT", "json")
+	p = resolve()
+	if p.URL != "http://env:8082" || p.Group != "env-cli" || p.Output != "json" || p.Username != "dev" {
+		t.Errorf("Expected env over profile got %+v", p)
+	}
+
+	// flags set on the command line over env, including the short alias
+	p = resolve("-url", "http://flag:8082", "-o", "yaml", "-timeout", "1s")
+	if p.URL != "http://flag:8082" || p.Output != "yaml" || p.Timeout != "1s" || p.Group != "env-cli" {
+		t.Errorf("Expected flags over env got %+v", p)
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// printer prints values as a table, JSON, JSON Lines, YAML or a Go template.
+type printer struct {
+	format string
+	tmpl   *template.Template
+	w      io.Writer
+}
+
+const (
+	tableOutput     = "table"
+	jsonOutput      = "json"
+	jsonLinesOutput = "jsonl"
+	yamlOutput      = "yaml"
+	templateOutput  = "template"
+)
+
+func newPrinter(w io.Writer, format, tmpl string) (*printer, error) {
+	p := &printer{format: format, w: w}
+
+	switch format {
+	case tableOutput, jsonOutput, jsonLinesOutput, yamlOutput:
+	case templateOutput:
+		if tmpl == "" {
+			return nil, errors.New("Error: template output requires -template")
+		}
+		t, err := template.New("output").Funcs(template.FuncMap{"json": toJSON}).Parse(tmpl)
+		if err != nil {
+			return nil, err
+		}
+		p.tmpl = t
+	default:
+		return nil, errors.Errorf("Error: unknown output %q, one of table, json, jsonl, yaml or template", format)
+	}
+
+	return p, nil
+}
+
+func (p *printer) print(v interface{}) error {
+	switch p.format {
+	case jsonOutput:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.w, string(b))
+		return err
+
+	case jsonLinesOutput:
+		rv := reflect.Indirect(reflect.ValueOf(v))
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return p.jsonLine(v)
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := p.jsonLine(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case yamlOutput:
+		generic, err := toGeneric(v)
+		if err != nil {
+			return err
+		}
+		var b bytes.Buffer
+		writeYAML(&b, generic, 0)
+		_, err = fmt.Fprint(p.w, "---\n"+b.String())
+		return err
+
+	case templateOutput:
+		generic, err := toGeneric(v)
+		if err != nil {
+			return err
+		}
+		if err := p.tmpl.Execute(p.w, generic); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(p.w)
+		return err
+
+	default:
+		return p.table(v)
+	}
+}
+
+func (p *printer) jsonLine(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(p.w, string(b))
+	return err
+}
+
+// table prints slices of structs as rows with a header, structs as name value lines followed by
+// their slice fields as tables, and anything else one value per line.
+func (p *printer) table(v interface{}) error {
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	rv := reflect.Indirect(reflect.ValueOf(v))
+
+	switch {
+	case isSliceOfStructs(rv):
+		writeRows(tw, rv)
+
+	case rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			fmt.Fprintln(tw, cell(rv.Index(i)))
+		}
+
+	case rv.Kind() == reflect.Struct:
+		var tables []int
+		for _, f := range fields(rv.Type()) {
+			fv := rv.Field(f.index)
+			if isSliceOfStructs(fv) {
+				tables = append(tables, f.index)
+				continue
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(f.name), cell(fv))
+		}
+		for _, i := range tables {
+			tw.Flush()
+			fmt.Fprintln(p.w)
+			writeRows(tw, rv.Field(i))
+		}
+
+	default:
+		fmt.Fprintln(tw, cell(rv))
+	}
+
+	return tw.Flush()
+}
+
+type field struct {
+	name  string
+	index int
+}
+
+// fields returns the exported fields of a struct type named by their json tag.
+func fields(t reflect.Type) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		fs = append(fs, field{name: name, index: i})
+	}
+	return fs
+}
+
+func writeRows(w io.Writer, rv reflect.Value) {
+	t := rv.Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	fs := fields(t)
+
+	header := make([]string, len(fs))
+	for i, f := range fs {
+		header[i] = strings.ToUpper(f.name)
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for i := 0; i < rv.Len(); i++ {
+		row := reflect.Indirect(rv.Index(i))
+		cells := make([]string, len(fs))
+		for j, f := range fs {
+			cells[j] = cell(row.Field(f.index))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+}
+
+func isSliceOfStructs(rv reflect.Value) bool {
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return false
+	}
+	t := rv.Type().Elem()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// cell formats scalars as is and anything else as compact JSON.
+func cell(rv reflect.Value) string {
+	if raw, ok := rv.Interface().(json.RawMessage); ok {
+		return string(raw)
+	}
+
+	rv = reflect.Indirect(rv)
+	switch rv.Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		s, _ := toJSON(rv.Interface())
+		return s
+	case reflect.Invalid:
+		return ""
+	default:
+		return fmt.Sprint(rv.Interface())
+	}
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+// toGeneric converts v to maps, slices and scalars through its JSON encoding.
+func toGeneric(v interface{}) (interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	var generic interface{}
+	err = d.Decode(&generic)
+	return generic, err
+}
+
+// writeYAML writes the generic value as block style YAML, map keys in sorted order.
+func writeYAML(b *bytes.Buffer, v interface{}, indent int) {
+	pad := strings.Repeat("  ", indent)
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) == 0 {
+			b.WriteString(pad + "{}\n")
+			return
+		}
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b.WriteString(pad + yamlKey(k) + ":")
+			writeYAMLValue(b, t[k], indent)
+		}
+
+	case []interface{}:
+		if len(t) == 0 {
+			b.WriteString(pad + "[]\n")
+			return
+		}
+		for _, e := range t {
+			if !isCollection(e) {
+				b.WriteString(pad + "-")
+				writeYAMLValue(b, e, indent)
+				continue
+			}
+			// the first line of a nested map or list goes after the dash
+			var nested bytes.Buffer
+			writeYAML(&nested, e, indent+1)
+			b.WriteString(pad + "- " + strings.TrimPrefix(nested.String(), pad+"  "))
+		}
+
+	default:
+		b.WriteString(pad + yamlScalar(t) + "\n")
+	}
+}
+
+func writeYAMLValue(b *bytes.Buffer, v interface{}, indent int) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) == 0 {
+			b.WriteString(" {}\n")
+			return
+		}
+		b.WriteString("\n")
+		writeYAML(b, t, indent+1)
+	case []interface{}:
+		if len(t) == 0 {
+			b.WriteString(" []\n")
+			return
+		}
+		b.WriteString("\n")
+		writeYAML(b, t, indent+1)
+	default:
+		b.WriteString(" " + yamlScalar(t) + "\n")
+	}
+}
+
+func isCollection(v interface{}) bool {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		return len(t) > 0
+	case []interface{}:
+		return len(t) > 0
+	}
+	return false
+}
+
+// yamlScalar writes strings double-quoted, so that none is read back as another type or breaks the document.
+func yamlScalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	case json.Number:
+		return t.String()
+	case string:
+		return strconv.Quote(t)
+	default:
+		return strconv.Quote(fmt.Sprint(t))
+	}
+}
+
+// yamlKey leaves plain the keys made of letters, digits, '_' and '-' starting with a letter or '_'
+// which YAML 1.1 does not read as booleans or null, the others are double-quoted.
+func yamlKey(k string) string {
+	switch strings.ToLower(k) {
+	case "", "y", "n", "yes", "no", "on", "off", "true", "false", "null":
+		return strconv.Quote(k)
+	}
+	for i, r := range k {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case i > 0 && (r == '-' || r >= '0' && r <= '9'):
+		default:
+			return strconv.Quote(k)
+		}
+	}
+	return k
+}
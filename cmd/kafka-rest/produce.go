@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/pkg/errors"
+)
+
+func runProduce(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("produce", flag.ExitOnError)
+	format := fs.String("format", c.profile.Format, "embedded format binary, json or avro, json and avro lines must be JSON")
+	partition := fs.Int("partition", -1, "partition to produce to, -1 lets the proxy choose")
+	keySeparator := fs.String("key-separator", "", "separator between key and value on each line, lines have no key if empty")
+	batch := fs.Int("batch", 100, "number of records per request")
+	keySchema := fs.String("key-schema", "", "Avro key schema")
+	valueSchema := fs.String("value-schema", "", "Avro value schema")
+	valueSchemaID := fs.Int("value-schema-id", 0, "Avro value schema id")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return errors.New("Error: produce requires a topic")
+	}
+	if *batch < 1 {
+		return errors.New("Error: batch must be positive")
+	}
+	topic := fs.Arg(0)
+
+	k := c.k
+	if err := k.SetOption(formatOption(K.Format(*format))); err != nil {
+		return err
+	}
+
+	ts := k.NewTopics()
+	ps := ts.NewPartitions()
+	message := &K.ProducerMessage{
+		KeySchema:     *keySchema,
+		ValueSchema:   *valueSchema,
+		ValueSchemaID: *valueSchemaID,
+	}
+
+	produced := 0
+	flush := func() error {
+		if len(message.Records) == 0 {
+			return nil
+		}
+
+		var pr *K.ProducerResponse
+		var err error
+		if *partition >= 0 {
+			pr, err = ps.ProduceContext(ctx, *partition, message, topic)
+		} else {
+			pr, err = ts.ProduceContext(ctx, topic, message)
+		}
+		if err != nil {
+			return err
+		}
+
+		produced += len(pr.Offsets)
+		message.Records = message.Records[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(c.stdin)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		record, err := parseRecord(K.Format(*format), line, *keySeparator)
+		if err != nil {
+			return err
+		}
+		message.Records = append(message.Records, record)
+
+		if len(message.Records) >= *batch {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stderr, "produced %d records to %s\n", produced, topic)
+	return nil
+}
+
+func parseRecord(format K.Format, line, keySeparator string) (K.ProducerRecord, error) {
+	record := K.ProducerRecord{}
+	value := line
+
+	if keySeparator != "" {
+		i := strings.Index(line, keySeparator)
+		if i < 0 {
+			return record, errors.Errorf("Error: no key separator %q in line %q", keySeparator, line)
+		}
+
+		key, err := encodeField(format, line[:i])
+		if err != nil {
+			return record, err
+		}
+		record.Key = key
+		value = line[i+len(keySeparator):]
+	}
+
+	v, err := encodeField(format, value)
+	if err != nil {
+		return record, err
+	}
+	record.Value = v
+
+	return record, nil
+}
+
+// encodeField encodes a key or value in the embedded format, base64 for binary, JSON as is otherwise.
+func encodeField(format K.Format, s string) (json.RawMessage, error) {
+	if format == K.Binary {
+		return json.Marshal(base64.StdEncoding.EncodeToString([]byte(s)))
+	}
+
+	if !json.Valid([]byte(s)) {
+		return nil, errors.Errorf("Error: invalid JSON %q", s)
+	}
+	return json.RawMessage(s), nil
+}
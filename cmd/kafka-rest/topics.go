@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/pkg/errors"
+)
+
+func runBrokers(ctx context.Context, c *cli, args []string) error {
+	b, err := c.k.BrokerContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.out.print(b.Brokers)
+}
+
+func runTopics(ctx context.Context, c *cli, args []string) error {
+	if len(args) == 0 {
+		return errors.New("Error: topics requires list or describe")
+	}
+
+	ts := c.k.NewTopics()
+	switch args[0] {
+	case "list":
+		names, err := ts.NamesContext(ctx)
+		if err != nil {
+			return err
+		}
+		return c.out.print(names)
+
+	case "describe":
+		fs := flag.NewFlagSet("topics describe", flag.ExitOnError)
+		fs.Parse(args[1:])
+		if fs.NArg() == 0 {
+			return errors.New("Error: topics describe requires a topic")
+		}
+
+		topics := make([]K.Topic, 0, fs.NArg())
+		for _, name := range fs.Args() {
+			t, err := ts.TopicContext(ctx, name)
+			if err != nil {
+				return err
+			}
+			topics = append(topics, t)
+		}
+		if len(topics) == 1 {
+			return c.out.print(topics[0])
+		}
+		return c.out.print(topics)
+
+	default:
+		return errors.Errorf("Error: unknown topics subcommand %q", args[0])
+	}
+}
+
+func runPartitions(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("partitions", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("Error: partitions requires a topic")
+	}
+
+	pss, err := c.k.NewTopics().NewPartitions().PartitionsContext(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return c.out.print(pss)
+}
@@ -0,0 +1,520 @@
+// Package conformance is a contract test suite for Kafka REST proxies.
+//
+// Run exercises the Kafka, Topics, Partitions and Consumers methods of package kafka end to end against a proxy,
+// checking status codes, payload shapes and semantics, to tell whether a proxy version is compatible:
+//
+//	func TestProxy(t *testing.T) {
+//		conformance.Run(t, "http://localhost:8082", conformance.SetTopic("conformance"))
+//	}
+//
+// The topic must exist, or be created by the proxy on first produce. Records are produced in binary format
+// with values unique to the run, so that the suite can run repeatedly against the same topic.
+package conformance
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Suite configures Run.
+	Suite struct {
+		// Topic is produced to and consumed from, default to conformance
+		Topic string
+		// Version is the API version, default to V2
+		Version K.Version
+		// ConsumerGroup is the consumer group, default to one unique to the run
+		ConsumerGroup string
+		// Timeout bounds waiting for produced records to be consumed, default to 30s
+		Timeout time.Duration
+		// KafkaOptions are applied to the Kafka instance after the suite settings, e.g. SetTransport
+		KafkaOptions []func(*K.Kafka) error
+	}
+
+	run struct {
+		Suite
+		k *K.Kafka
+		// id is unique to the run, in the values of the records produced
+		id       string
+		produced []K.ProducerOffsets
+	}
+)
+
+const records = 5
+
+// SetTopic applies Topic to Suite.
+func SetTopic(topic string) func(*Suite) error {
+	return func(s *Suite) error {
+		s.Topic = topic
+		return nil
+	}
+}
+
+// SetVersion applies Version to Suite.
+func SetVersion(version K.Version) func(*Suite) error {
+	return func(s *Suite) error {
+		switch version {
+		case K.V1, K.V2:
+			s.Version = version
+			return nil
+		default:
+			return errors.Errorf("Error: unknown API version %q", version)
+		}
+	}
+}
+
+// SetConsumerGroup applies ConsumerGroup to Suite.
+func SetConsumerGroup(consumerGroup string) func(*Suite) error {
+	return func(s *Suite) error {
+		s.ConsumerGroup = consumerGroup
+		return nil
+	}
+}
+
+// SetTimeout applies Timeout to Suite.
+func SetTimeout(timeout time.Duration) func(*Suite) error {
+	return func(s *Suite) error {
+		s.Timeout = timeout
+		return nil
+	}
+}
+
+// KafkaOptions appends options to Suite.KafkaOptions.
+func KafkaOptions(options ...func(*K.Kafka) error) func(*Suite) error {
+	return func(s *Suite) error {
+		s.KafkaOptions = append(s.KafkaOptions, options...)
+		return nil
+	}
+}
+
+// Run runs the suite against the REST proxy at baseURL, each group of methods as a subtest.
+// Subtests depending on produced records are skipped if producing fails.
+func Run(t *testing.T, baseURL string, options ...func(*Suite) error) {
+	t.Helper()
+
+	s := Suite{Topic: "conformance", Version: K.V2, Timeout: 30 * time.Second}
+	for _, opt := range options {
+		if err := opt(&s); err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+	}
+
+	r := &run{Suite: s, id: strconv.FormatInt(time.Now().UnixNano(), 36)}
+	if r.ConsumerGroup == "" {
+		r.ConsumerGroup = "conformance-" + r.id
+	}
+
+	mediaType := fmt.Sprintf("application/vnd.kafka.binary.%s+json", s.Version)
+	k, err := K.New(append([]func(*K.Kafka) error{
+		K.SetURL(baseURL),
+		func(k *K.Kafka) error {
+			k.Version = s.Version
+			return nil
+		},
+		K.BinaryFormat,
+		K.SetAccept(fmt.Sprintf("%s, application/vnd.kafka.%s+json, application/json", mediaType, s.Version)),
+		K.SetContentType(mediaType),
+		K.SetMetadataTTL(0),
+	}, s.KafkaOptions...)...)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	r.k = k
+
+	t.Run("Broker", r.broker)
+	if !t.Run("Produce", r.produce) {
+		return
+	}
+	t.Run("Topics", r.topics)
+	t.Run("Partitions", r.partitions)
+
+	if s.Version == K.V1 {
+		t.Run("PartitionMessages", r.partitionMessages)
+		t.Run("ConsumerV1", r.consumerV1)
+		return
+	}
+	t.Run("PartitionOffsets", r.partitionOffsets)
+	t.Run("Consumer", r.consumer)
+}
+
+func (r *run) context(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), r.Timeout)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// value returns the binary value of the i-th record of the run.
+func (r *run) value(i int) json.RawMessage {
+	b, _ := json.Marshal(base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("conformance-%s-%d", r.id, i))))
+	return b
+}
+
+// index returns the index of the record of the run with the message value, -1 if it is not one.
+func (r *run) index(m K.Message) int {
+	var s string
+	if json.Unmarshal(m.Value, &s) != nil {
+		return -1
+	}
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return -1
+	}
+
+	for i := 0; i < records; i++ {
+		if string(b) == fmt.Sprintf("conformance-%s-%d", r.id, i) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *run) broker(t *testing.T) {
+	b, err := r.k.BrokerContext(r.context(t))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(b.Brokers) == 0 {
+		t.Error("Expected brokers got none")
+	}
+}
+
+func (r *run) produce(t *testing.T) {
+	message := &K.ProducerMessage{}
+	for i := 0; i < records; i++ {
+		key, _ := json.Marshal(base64.StdEncoding.EncodeToString([]byte("key-" + strconv.Itoa(i))))
+		message.Records = append(message.Records, K.ProducerRecord{Key: key, Value: r.value(i)})
+	}
+
+	pr, err := r.k.NewTopics().ProduceContext(r.context(t), r.Topic, message)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(pr.Offsets) != records {
+		t.Fatalf("Expected %d offsets got %+v", records, pr.Offsets)
+	}
+	for _, o := range pr.Offsets {
+		if o.ErrorCode != 0 || o.Partition < 0 || o.Offset < 0 {
+			t.Fatalf("Expected offsets without errors got %+v", pr.Offsets)
+		}
+	}
+
+	r.produced = pr.Offsets
+}
+
+func (r *run) topics(t *testing.T) {
+	ctx := r.context(t)
+	ts := r.k.NewTopics()
+
+	names, err := ts.NamesContext(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if !contains(names, r.Topic) {
+		t.Errorf("Expected topic %v in %v", r.Topic, names)
+	}
+
+	topic, err := ts.TopicContext(ctx, r.Topic)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if topic.Name != r.Topic || len(topic.Partitions) == 0 || len(topic.Configs) == 0 {
+		t.Errorf("Expected topic %v with partitions and configs got %+v", r.Topic, topic)
+	}
+
+	list, err := ts.TopicsContext(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	found := false
+	for _, lt := range list {
+		found = found || lt.Name == r.Topic
+	}
+	if !found {
+		t.Errorf("Expected topic %v in topics", r.Topic)
+	}
+
+	_, err = ts.TopicContext(ctx, "conformance-missing-"+r.id)
+	if !K.IsTopicNotFound(err) {
+		t.Errorf("Expected topic not found got %v", err)
+	}
+}
+
+func (r *run) partitions(t *testing.T) {
+	ctx := r.context(t)
+	ps := r.k.NewTopics().NewPartitions()
+
+	pss, err := ps.PartitionsContext(ctx, r.Topic)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(pss) == 0 {
+		t.Fatal("Expected partitions got none")
+	}
+	for _, p := range pss {
+		leader := false
+		for _, replica := range p.Replicas {
+			leader = leader || (replica.Leader && replica.Broker == p.Leader)
+		}
+		if !leader {
+			t.Errorf("Expected leader %v among replicas got %+v", p.Leader, p)
+		}
+	}
+
+	p, err := ps.PartitionContext(ctx, pss[0].Partition, r.Topic)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if p.Partition != pss[0].Partition || p.Leader != pss[0].Leader {
+		t.Errorf("Expected partition %+v got %+v", pss[0], p)
+	}
+
+	message := &K.ProducerMessage{Records: []K.ProducerRecord{{Value: r.value(records)}}}
+	pr, err := ps.ProduceContext(ctx, p.Partition, message, r.Topic)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(pr.Offsets) != 1 || pr.Offsets[0].Partition != p.Partition {
+		t.Errorf("Expected offset in partition %v got %+v", p.Partition, pr.Offsets)
+	}
+}
+
+func (r *run) partitionOffsets(t *testing.T) {
+	ctx := r.context(t)
+	ps := r.k.NewTopics().NewPartitions()
+
+	for _, o := range r.produced {
+		po, err := ps.Offsets(ctx, o.Partition, r.Topic)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if po.BeginningOffset > o.Offset || po.EndOffset <= o.Offset {
+			t.Errorf("Expected offsets around %v got %+v", o.Offset, po)
+		}
+	}
+}
+
+func (r *run) partitionMessages(t *testing.T) {
+	ctx := r.context(t)
+	ps := r.k.NewTopics().NewPartitions()
+
+	for i, o := range r.produced {
+		m, err := ps.Messages(ctx, o.Partition, o.Offset, 1, r.Topic)
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if len(m) != 1 || m[0].Offset != o.Offset || r.index(m[0]) != i {
+			t.Errorf("Expected record %d at offset %v got %+v", i, o.Offset, m)
+		}
+	}
+}
+
+// consumer runs the consumer instance lifecycle of API v2.
+func (r *run) consumer(t *testing.T) {
+	ctx := r.context(t)
+	cs := r.k.NewConsumers(r.ConsumerGroup)
+
+	ci, err := cs.NewConsumerContext(ctx, &K.ConsumerRequest{Format: K.Binary, Offset: K.Earliest, AutoCommit: "false"})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if ci.ConsumerName == "" || ci.BaseURI == "" {
+		t.Fatalf("Expected instance id and base URI got %+v", ci)
+	}
+	name := ci.ConsumerName
+	deleted := false
+	defer func() {
+		if !deleted {
+			cs.DeleteConsumerContext(context.Background(), name)
+		}
+	}()
+
+	subscription := &K.TopicSubscription{Topics: &K.TopicsSubscription{Topics: []string{r.Topic}}}
+	if err := cs.SubscribeContext(ctx, subscription, false, name); err != nil {
+		t.Fatalf("Subscribe: expected no error got %v", err)
+	}
+	sub, err := cs.SubscriptionsContext(ctx, name)
+	if err != nil || !contains(sub.Topics, r.Topic) {
+		t.Fatalf("Subscriptions: expected topic %v got %+v %v", r.Topic, sub, err)
+	}
+
+	// consumes the records of the run
+	seen := map[int]bool{}
+	err = r.fetch(ctx, cs, name, func(m K.Message) bool {
+		if i := r.index(m); i >= 0 && i < records {
+			seen[i] = true
+		}
+		return len(seen) == records
+	})
+	if err != nil {
+		t.Fatalf("Records: expected all %d records got %d %v", records, len(seen), err)
+	}
+
+	offsets := &K.ConsumerOffsets{}
+	partitions := &K.ConsumerOffsetsPartitions{}
+	for _, o := range r.produced {
+		offsets.Offsets = append(offsets.Offsets, K.ConsumerOffset{Topic: r.Topic, Partition: o.Partition, Offset: o.Offset + 1})
+		partitions.Partitions = append(partitions.Partitions, K.ConsumerPartitions{Topic: r.Topic, Partition: o.Partition})
+	}
+	if err := cs.CommitOffsetsContext(ctx, offsets, name); err != nil {
+		t.Fatalf("CommitOffsets: expected no error got %v", err)
+	}
+	committed, err := cs.OffsetsContext(ctx, partitions, name)
+	if err != nil {
+		t.Fatalf("Offsets: expected no error got %v", err)
+	}
+	for _, o := range r.produced {
+		found := false
+		for _, co := range committed.Offsets {
+			found = found || (co.Topic == r.Topic && co.Partition == o.Partition && co.Offset > o.Offset)
+		}
+		if !found {
+			t.Errorf("Offsets: expected committed offset past %v got %+v", o, committed.Offsets)
+		}
+	}
+
+	if err := cs.UnsubscribeContext(ctx, name); err != nil {
+		t.Fatalf("Unsubscribe: expected no error got %v", err)
+	}
+	sub, err = cs.SubscriptionsContext(ctx, name)
+	if err != nil || len(sub.Topics) != 0 {
+		t.Fatalf("Subscriptions: expected none got %+v %v", sub, err)
+	}
+
+	first := r.produced[0]
+	tp := K.ConsumerPartitions{Topic: r.Topic, Partition: first.Partition}
+	assignment := &K.ConsumerOffsetsPartitions{Partitions: []K.ConsumerPartitions{tp}}
+	if err := cs.AssignContext(ctx, assignment, name); err != nil {
+		t.Fatalf("Assign: expected no error got %v", err)
+	}
+	assigned, err := cs.AssignmentsContext(ctx, name)
+	if err != nil || len(assigned.Partitions) != 1 || assigned.Partitions[0] != tp {
+		t.Fatalf("Assignments: expected %+v got %+v %v", tp, assigned, err)
+	}
+
+	seek := &K.ConsumerOffsets{Offsets: []K.ConsumerOffset{{Topic: r.Topic, Partition: first.Partition, Offset: first.Offset}}}
+	if err := cs.SeekContext(ctx, seek, name); err != nil {
+		t.Fatalf("Seek: expected no error got %v", err)
+	}
+	var at K.Message
+	err = r.fetch(ctx, cs, name, func(m K.Message) bool {
+		at = m
+		return true
+	})
+	if err != nil || at.Offset != first.Offset || r.index(at) != 0 {
+		t.Fatalf("Seek: expected record 0 at offset %v got %+v %v", first.Offset, at, err)
+	}
+
+	if err := cs.SeekToBeginningContext(ctx, assignment, name); err != nil {
+		t.Fatalf("SeekToBeginning: expected no error got %v", err)
+	}
+	err = r.fetch(ctx, cs, name, func(m K.Message) bool {
+		at = m
+		return true
+	})
+	if err != nil || at.Offset > first.Offset {
+		t.Fatalf("SeekToBeginning: expected a record up to offset %v got %+v %v", first.Offset, at, err)
+	}
+
+	if err := cs.SeekToEndContext(ctx, assignment, name); err != nil {
+		t.Fatalf("SeekToEnd: expected no error got %v", err)
+	}
+	m, err := cs.RecordsContext(ctx, K.Argument{ConsumerName: name, Timeout: 500})
+	if err != nil {
+		t.Fatalf("SeekToEnd: expected no error got %v", err)
+	}
+	for _, msg := range m {
+		if msg.Offset <= first.Offset {
+			t.Errorf("SeekToEnd: expected records after offset %v got %+v", first.Offset, msg)
+		}
+	}
+
+	if err := cs.DeleteConsumerContext(ctx, name); err != nil {
+		t.Fatalf("DeleteConsumer: expected no error got %v", err)
+	}
+	deleted = true
+	if _, err := cs.SubscriptionsContext(ctx, name); !K.IsConsumerInstanceNotFound(err) {
+		t.Errorf("Expected consumer instance not found got %v", err)
+	}
+}
+
+// consumerV1 runs the consumer instance lifecycle of API v1.
+func (r *run) consumerV1(t *testing.T) {
+	ctx := r.context(t)
+	cs := r.k.NewConsumers(r.ConsumerGroup)
+
+	ci, err := cs.NewConsumerContext(ctx, &K.ConsumerRequest{Format: K.Binary, Offset: K.Smallest, AutoCommit: "false"})
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if ci.ConsumerName == "" || ci.BaseURI == "" {
+		t.Fatalf("Expected instance id and base URI got %+v", ci)
+	}
+	name := ci.ConsumerName
+	defer cs.DeleteConsumerContext(context.Background(), name)
+
+	seen := map[int]bool{}
+	for len(seen) < records {
+		m, err := cs.MessagesContext(ctx, K.Argument{ConsumerName: name, TopicName: r.Topic})
+		if err != nil {
+			t.Fatalf("Messages: expected all %d records got %d %v", records, len(seen), err)
+		}
+		for _, msg := range m {
+			if i := r.index(msg); i >= 0 && i < records {
+				seen[i] = true
+			}
+		}
+		if len(m) == 0 && !sleep(ctx, 100*time.Millisecond) {
+			t.Fatalf("Messages: expected all %d records got %d %v", records, len(seen), ctx.Err())
+		}
+	}
+
+	if err := cs.CommitOffsetsContext(ctx, &K.ConsumerOffsets{}, name); err != nil {
+		t.Fatalf("CommitOffsets: expected no error got %v", err)
+	}
+}
+
+// fetch fetches records until done returns true for one of them or ctx is done.
+func (r *run) fetch(ctx context.Context, cs *K.Consumers, name string, done func(K.Message) bool) error {
+	for {
+		m, err := cs.RecordsContext(ctx, K.Argument{ConsumerName: name, Timeout: 1000})
+		if err != nil {
+			return err
+		}
+		for _, msg := range m {
+			if done(msg) {
+				return nil
+			}
+		}
+		if len(m) == 0 && !sleep(ctx, 100*time.Millisecond) {
+			return ctx.Err()
+		}
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package conformance_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/andy2046/kafka-rest-go/conformance"
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/andy2046/kafka-rest-go/kafkatest"
+)
+
+func TestKafkatest(t *testing.T) {
+	for _, version := range []K.Version{K.V1, K.V2} {
+		t.Run(string(version), func(t *testing.T) {
+			s, _ := kafkatest.NewServer(kafkatest.SetBrokers(1, 2, 3))
+			defer s.Close()
+			s.CreateTopic("conformance", 3)
+
+			conformance.Run(t, s.URL, conformance.SetVersion(version))
+		})
+	}
+}
+
+// TestProxy runs the suite against the proxy at $KAFKA_REST_CONFORMANCE_URL, if set.
+func TestProxy(t *testing.T) {
+	url := os.Getenv("KAFKA_REST_CONFORMANCE_URL")
+	if url == "" {
+		t.Skip("KAFKA_REST_CONFORMANCE_URL not set")
+	}
+
+	conformance.Run(t, url)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -119,10 +120,11 @@ func main() {
 		ConsumerName:  ci.ConsumerName,
 	}
 
-	// keep polling messages until cancelled or error
-	cancelFunc := c.Poll(3000, mArg, func(err error, msg []K.Message) {
+	// keep polling messages until cancelled, transient errors are retried with backoff
+	cancelFunc := c.Poll(context.Background(), 3*time.Second, mArg, func(err error, msg []K.Message) {
 		if err != nil {
-			panic(err)
+			fmt.Println(err)
+			return
 		}
 		fmt.Println("Records:")
 		for _, m := range msg {
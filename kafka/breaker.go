@@ -0,0 +1,294 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// CircuitBreaker configures a circuit breaker per endpoint of the REST proxy, so that calls fail fast
+	// with ErrCircuitOpen while it is degraded. A request fails if it gets no response or a 5xx status code.
+	// The circuit of an endpoint opens after ConsecutiveFailures, or when the rate of failures of its last Window
+	// requests reaches FailureRate. After OpenTimeout it is half-open, HalfOpenProbes requests are let through,
+	// it closes if all of them succeed and opens again as soon as one fails.
+	CircuitBreaker struct {
+		// ConsecutiveFailures opening the circuit, disabled if 0
+		ConsecutiveFailures int
+		// FailureRate in (0, 1] opening the circuit, disabled if 0
+		FailureRate float64
+		// Window is the number of last requests FailureRate is computed over, once as many are made. Default to 20.
+		Window int
+		// OpenTimeout is how long the circuit stays open before it is half-open. Default to 30s.
+		OpenTimeout time.Duration
+		// HalfOpenProbes is the number of requests let through while half-open. Default to 1.
+		HalfOpenProbes int
+		// OnStateChange (optional) is called when the circuit of the endpoint, an Endpoint.Name, changes state.
+		// It is called synchronously by the request which changes the state, so it must not block.
+		OnStateChange func(endpoint string, from, to CircuitState)
+	}
+
+	// CircuitState is the state of a circuit breaker
+	CircuitState int
+
+	// breakers are the circuits of Kafka per endpoint, created on first use.
+	breakers struct {
+		config CircuitBreaker
+
+		mu       sync.Mutex
+		circuits map[string]*circuit
+	}
+
+	circuit struct {
+		state  CircuitState
+		opened time.Time
+		// consecutive is the number of consecutive failures
+		consecutive int
+		// outcomes are the failures of the last Window requests, in a ring buffer from next
+		outcomes []bool
+		next     int
+		failures int
+		// probes are the half-open requests in flight, successes those which succeeded
+		probes    int
+		successes int
+	}
+
+	breakerTransport struct {
+		kafka *Kafka
+		base  http.RoundTripper
+	}
+)
+
+const (
+	// CircuitClosed lets requests through
+	CircuitClosed CircuitState = iota
+	// CircuitOpen fails requests fast with ErrCircuitOpen
+	CircuitOpen
+	// CircuitHalfOpen lets HalfOpenProbes requests through to probe whether the endpoint recovered
+	CircuitHalfOpen
+
+	defaultBreakerWindow      = 20
+	defaultBreakerOpenTimeout = 30 * time.Second
+)
+
+// ErrCircuitOpen is the cause of the errors of requests failed fast by an open CircuitBreaker.
+var ErrCircuitOpen = errors.New("Error: circuit breaker open")
+
+// String implements fmt.Stringer.
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// IsCircuitOpen reports whether err is caused by an open CircuitBreaker.
+func IsCircuitOpen(err error) bool {
+	return errors.Is(err, ErrCircuitOpen)
+}
+
+// SetCircuitBreaker applies CircuitBreaker to Kafka.
+func SetCircuitBreaker(cb CircuitBreaker) func(*Kafka) error {
+	return func(k *Kafka) error {
+		if cb.ConsecutiveFailures < 0 || cb.FailureRate < 0 || cb.FailureRate > 1 || cb.Window < 0 ||
+			cb.OpenTimeout < 0 || cb.HalfOpenProbes < 0 {
+			return errors.New("Error: invalid CircuitBreaker")
+		}
+		k.CircuitBreaker = &cb
+		return nil
+	}
+}
+
+// CircuitState returns the state of the circuit of the endpoint, an Endpoint.Name,
+// CircuitClosed if CircuitBreaker is not set or no request has been made to the endpoint.
+func (k *Kafka) CircuitState(endpoint string) CircuitState {
+	if k.CircuitBreaker == nil {
+		return CircuitClosed
+	}
+
+	bs := k.breakers()
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	c, ok := bs.circuits[endpoint]
+	if !ok {
+		return CircuitClosed
+	}
+	if c.state == CircuitOpen && time.Since(c.opened) >= bs.config.OpenTimeout {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+// breakers returns the circuit breakers of Kafka, created from CircuitBreaker on first use.
+func (k *Kafka) breakers() *breakers {
+	defer k.lock()()
+
+	if k.circuits == nil {
+		config := *k.CircuitBreaker
+		if config.Window <= 0 {
+			config.Window = defaultBreakerWindow
+		}
+		if config.OpenTimeout <= 0 {
+			config.OpenTimeout = defaultBreakerOpenTimeout
+		}
+		if config.HalfOpenProbes <= 0 {
+			config.HalfOpenProbes = 1
+		}
+		k.circuits = &breakers{config: config, circuits: make(map[string]*circuit)}
+	}
+	return k.circuits
+}
+
+// allow reports whether a request to the endpoint may be made, and the state change it causes if any.
+func (bs *breakers) allow(endpoint string) (bool, CircuitState, CircuitState) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	c, ok := bs.circuits[endpoint]
+	if !ok {
+		c = &circuit{outcomes: make([]bool, 0, bs.config.Window)}
+		bs.circuits[endpoint] = c
+	}
+
+	from := c.state
+	switch c.state {
+	case CircuitOpen:
+		if time.Since(c.opened) < bs.config.OpenTimeout {
+			return false, from, from
+		}
+		c.state, c.probes, c.successes = CircuitHalfOpen, 0, 0
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probes >= bs.config.HalfOpenProbes {
+			return false, from, c.state
+		}
+		c.probes++
+	}
+	return true, from, c.state
+}
+
+// done records the outcome of a request to the endpoint, returning the state change it causes if any.
+// A request whose outcome is unknown, e.g. canceled by its caller, only frees its half-open probe.
+func (bs *breakers) done(endpoint string, failed, unknown bool) (CircuitState, CircuitState) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	c := bs.circuits[endpoint]
+	from := c.state
+
+	if c.state == CircuitHalfOpen {
+		c.probes--
+		switch {
+		case unknown:
+		case failed:
+			c.open()
+		default:
+			c.successes++
+			if c.successes >= bs.config.HalfOpenProbes {
+				c.close()
+			}
+		}
+		return from, c.state
+	}
+	if unknown || c.state == CircuitOpen {
+		return from, from
+	}
+
+	c.record(failed, bs.config.Window)
+	if failed && bs.tripped(c) {
+		c.open()
+	}
+	return from, c.state
+}
+
+// tripped reports whether the failures of the closed circuit reach the thresholds.
+func (bs *breakers) tripped(c *circuit) bool {
+	if n := bs.config.ConsecutiveFailures; n > 0 && c.consecutive >= n {
+		return true
+	}
+	rate := bs.config.FailureRate
+	return rate > 0 && len(c.outcomes) == bs.config.Window && float64(c.failures) >= rate*float64(bs.config.Window)
+}
+
+func (c *circuit) record(failed bool, window int) {
+	if failed {
+		c.consecutive++
+		c.failures++
+	} else {
+		c.consecutive = 0
+	}
+
+	if len(c.outcomes) < window {
+		c.outcomes = append(c.outcomes, failed)
+		return
+	}
+	if c.outcomes[c.next] {
+		c.failures--
+	}
+	c.outcomes[c.next] = failed
+	c.next = (c.next + 1) % window
+}
+
+func (c *circuit) open() {
+	c.state, c.opened = CircuitOpen, time.Now()
+}
+
+func (c *circuit) close() {
+	*c = circuit{outcomes: c.outcomes[:0]}
+}
+
+// changed reports the state change of the circuit of the endpoint, if any.
+func (t *breakerTransport) changed(ctx context.Context, endpoint string, from, to CircuitState) {
+	if from == to {
+		return
+	}
+
+	level := slog.LevelInfo
+	if to == CircuitOpen {
+		level = slog.LevelWarn
+	}
+	t.kafka.logger().LogAttrs(ctx, level, "kafka: circuit breaker state changed",
+		slog.String("endpoint", endpoint), slog.String("from", from.String()), slog.String("to", to.String()))
+
+	if cb := t.kafka.CircuitBreaker; cb.OnStateChange != nil {
+		cb.OnStateChange(endpoint, from, to)
+	}
+}
+
+// RoundTrip implements http.RoundTripper, failing fast with ErrCircuitOpen while the circuit of the endpoint is open.
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	e, ok := EndpointFrom(ctx)
+	if !ok {
+		e = Endpoint{Name: req.Method, Partition: -1}
+	}
+	bs := t.kafka.breakers()
+
+	allowed, from, to := bs.allow(e.Name)
+	t.changed(ctx, e.Name, from, to)
+	if !allowed {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, errors.Wrap(ErrCircuitOpen, e.Name)
+	}
+
+	res, err := t.base.RoundTrip(req)
+	failed := err != nil || res.StatusCode >= http.StatusInternalServerError
+	unknown := err != nil && ctx.Err() != nil && !errors.Is(ctx.Err(), context.DeadlineExceeded)
+
+	from, to = bs.done(e.Name, failed, unknown)
+	t.changed(ctx, e.Name, from, to)
+	return res, err
+}
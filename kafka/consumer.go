@@ -2,8 +2,9 @@ package kafka
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"io"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
@@ -11,6 +12,8 @@ import (
 	"github.com/pkg/errors"
 )
 
+const defaultStreamBuffer = 100
+
 type (
 	// ConsumerRequest is the metadata needed to create a consumer instance
 	ConsumerRequest struct {
@@ -80,6 +83,7 @@ type (
 		Value     json.RawMessage `json:"value"`
 		Partition int             `json:"partition"`
 		Offset    int64           `json:"offset"`
+		Headers   []Header        `json:"headers,omitempty"`
 	}
 
 	// Argument is the argument for both method Records and Messages
@@ -94,6 +98,11 @@ type (
 
 // NewConsumer creates a new consumer instance in the consumer group.
 func (cs *Consumers) NewConsumer(consumerRequest *ConsumerRequest, consumerGroup ...string) (*ConsumerInstance, error) {
+	return cs.NewConsumerContext(context.Background(), consumerRequest, consumerGroup...)
+}
+
+// NewConsumerContext is like NewConsumer but with a context.
+func (cs *Consumers) NewConsumerContext(ctx context.Context, consumerRequest *ConsumerRequest, consumerGroup ...string) (*ConsumerInstance, error) {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return nil, err
@@ -103,6 +112,7 @@ func (cs *Consumers) NewConsumer(consumerRequest *ConsumerRequest, consumerGroup
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "POST /consumers/{group}", Group: cg, Partition: -1})
 
 	b := &bytes.Buffer{}
 	json.NewEncoder(b).Encode(consumerRequest)
@@ -120,23 +130,31 @@ func (cs *Consumers) NewConsumer(consumerRequest *ConsumerRequest, consumerGroup
 			return err
 		}
 
-		err = json.NewDecoder(res.Body).Decode(ci)
-		if err != nil && err != io.EOF {
+		err = cs.Kafka.decode(res, ci)
+		if err != nil {
 			return err
 		}
 		return nil
 	}
 
-	err = doRequest("POST", url, cs.Kafka.HTTPClient(), b, requestHooker, responseHooker)
+	err = doRequest(ctx, "POST", url, cs.Kafka.HTTPClient(), b, requestHooker, responseHooker)
 	if err != nil {
 		return nil, err
 	}
 
+	cs.Kafka.logger().LogAttrs(ctx, slog.LevelInfo, "kafka: consumer instance created",
+		slog.String("group", cg), slog.String("instance", ci.ConsumerName))
+
 	return ci, nil
 }
 
 // DeleteConsumer destroy the consumer instance.
 func (cs *Consumers) DeleteConsumer(consumerName string, consumerGroup ...string) error {
+	return cs.DeleteConsumerContext(context.Background(), consumerName, consumerGroup...)
+}
+
+// DeleteConsumerContext is like DeleteConsumer but with a context.
+func (cs *Consumers) DeleteConsumerContext(ctx context.Context, consumerName string, consumerGroup ...string) error {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return err
@@ -147,8 +165,9 @@ func (cs *Consumers) DeleteConsumer(consumerName string, consumerGroup ...string
 	if err != nil {
 		return err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "DELETE /consumers/{group}/instances/{instance}", Group: cg, Instance: consumerName, Partition: -1})
 
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return err
 	}
@@ -166,11 +185,28 @@ func (cs *Consumers) DeleteConsumer(consumerName string, consumerGroup ...string
 		return err
 	}
 
+	cs.Kafka.logger().LogAttrs(ctx, slog.LevelInfo, "kafka: consumer instance deleted",
+		slog.String("group", cg), slog.String("instance", consumerName))
+
 	return nil
 }
 
 // CommitOffsets commits a list of offsets for the consumer.
 func (cs *Consumers) CommitOffsets(consumerOffsets *ConsumerOffsets, consumerName string, consumerGroup ...string) error {
+	return cs.CommitOffsetsContext(context.Background(), consumerOffsets, consumerName, consumerGroup...)
+}
+
+// CommitOffsetsContext is like CommitOffsets but with a context.
+func (cs *Consumers) CommitOffsetsContext(ctx context.Context, consumerOffsets *ConsumerOffsets, consumerName string, consumerGroup ...string) error {
+	start := time.Now()
+	err := cs.commitOffsets(ctx, consumerOffsets, consumerName, consumerGroup...)
+	cg, _ := getConsumerGroup(cs, consumerGroup)
+	cs.Kafka.metrics().Committed(cg, time.Since(start), err)
+	cs.Kafka.logCommitted(ctx, cg, consumerName, consumerOffsets, err)
+	return err
+}
+
+func (cs *Consumers) commitOffsets(ctx context.Context, consumerOffsets *ConsumerOffsets, consumerName string, consumerGroup ...string) error {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return err
@@ -181,10 +217,11 @@ func (cs *Consumers) CommitOffsets(consumerOffsets *ConsumerOffsets, consumerNam
 	if err != nil {
 		return err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "POST /consumers/{group}/instances/{instance}/offsets", Group: cg, Instance: consumerName, Partition: -1})
 
 	b := &bytes.Buffer{}
 	json.NewEncoder(b).Encode(consumerOffsets)
-	req, err := http.NewRequest("POST", url, b)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, b)
 	if err != nil {
 		return err
 	}
@@ -207,6 +244,11 @@ func (cs *Consumers) CommitOffsets(consumerOffsets *ConsumerOffsets, consumerNam
 
 // Offsets get the last committed offsets for the given partitions.
 func (cs *Consumers) Offsets(consumerOffsetsPartitions *ConsumerOffsetsPartitions, consumerName string, consumerGroup ...string) (*ConsumerOffsets, error) {
+	return cs.OffsetsContext(context.Background(), consumerOffsetsPartitions, consumerName, consumerGroup...)
+}
+
+// OffsetsContext is like Offsets but with a context.
+func (cs *Consumers) OffsetsContext(ctx context.Context, consumerOffsetsPartitions *ConsumerOffsetsPartitions, consumerName string, consumerGroup ...string) (*ConsumerOffsets, error) {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return nil, err
@@ -217,10 +259,11 @@ func (cs *Consumers) Offsets(consumerOffsetsPartitions *ConsumerOffsetsPartition
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /consumers/{group}/instances/{instance}/offsets", Group: cg, Instance: consumerName, Partition: -1})
 
 	b := &bytes.Buffer{}
 	json.NewEncoder(b).Encode(consumerOffsetsPartitions)
-	req, err := http.NewRequest("GET", url, b)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, b)
 	if err != nil {
 		return nil, err
 	}
@@ -239,8 +282,8 @@ func (cs *Consumers) Offsets(consumerOffsetsPartitions *ConsumerOffsetsPartition
 
 	cresp := &ConsumerOffsets{}
 
-	err = json.NewDecoder(res.Body).Decode(cresp)
-	if err != nil && err != io.EOF {
+	err = cs.Kafka.decode(res, cresp)
+	if err != nil {
 		return nil, err
 	}
 
@@ -249,6 +292,11 @@ func (cs *Consumers) Offsets(consumerOffsetsPartitions *ConsumerOffsetsPartition
 
 // Subscribe to the given list of topics or a topic pattern.
 func (cs *Consumers) Subscribe(topicSubscription *TopicSubscription, useTopicPattern bool, consumerName string, consumerGroup ...string) error {
+	return cs.SubscribeContext(context.Background(), topicSubscription, useTopicPattern, consumerName, consumerGroup...)
+}
+
+// SubscribeContext is like Subscribe but with a context.
+func (cs *Consumers) SubscribeContext(ctx context.Context, topicSubscription *TopicSubscription, useTopicPattern bool, consumerName string, consumerGroup ...string) error {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return err
@@ -259,6 +307,15 @@ func (cs *Consumers) Subscribe(topicSubscription *TopicSubscription, useTopicPat
 	if err != nil {
 		return err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "POST /consumers/{group}/instances/{instance}/subscription", Group: cg, Instance: consumerName, Partition: -1})
+
+	if !useTopicPattern && topicSubscription.Topics != nil {
+		for _, topicName := range topicSubscription.Topics.Topics {
+			if err := ValidateTopicName(topicName); err != nil {
+				return err
+			}
+		}
+	}
 
 	b := &bytes.Buffer{}
 	switch {
@@ -268,7 +325,7 @@ func (cs *Consumers) Subscribe(topicSubscription *TopicSubscription, useTopicPat
 		json.NewEncoder(b).Encode(topicSubscription.Topics)
 	}
 
-	req, err := http.NewRequest("POST", url, b)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, b)
 	if err != nil {
 		return err
 	}
@@ -286,11 +343,25 @@ func (cs *Consumers) Subscribe(topicSubscription *TopicSubscription, useTopicPat
 		return err
 	}
 
+	attrs := []slog.Attr{slog.String("group", cg), slog.String("instance", consumerName)}
+	switch {
+	case useTopicPattern && topicSubscription.TopicPattern != nil:
+		attrs = append(attrs, slog.String("topic_pattern", topicSubscription.TopicPattern.TopicPattern))
+	case !useTopicPattern && topicSubscription.Topics != nil:
+		attrs = append(attrs, slog.Any("topics", topicSubscription.Topics.Topics))
+	}
+	cs.Kafka.logger().LogAttrs(ctx, slog.LevelInfo, "kafka: subscribed", attrs...)
+
 	return nil
 }
 
 // Subscriptions get the current subscribed list of topics.
 func (cs *Consumers) Subscriptions(consumerName string, consumerGroup ...string) (*TopicsSubscription, error) {
+	return cs.SubscriptionsContext(context.Background(), consumerName, consumerGroup...)
+}
+
+// SubscriptionsContext is like Subscriptions but with a context.
+func (cs *Consumers) SubscriptionsContext(ctx context.Context, consumerName string, consumerGroup ...string) (*TopicsSubscription, error) {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return nil, err
@@ -301,8 +372,9 @@ func (cs *Consumers) Subscriptions(consumerName string, consumerGroup ...string)
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /consumers/{group}/instances/{instance}/subscription", Group: cg, Instance: consumerName, Partition: -1})
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -321,8 +393,8 @@ func (cs *Consumers) Subscriptions(consumerName string, consumerGroup ...string)
 
 	tsub := &TopicsSubscription{}
 
-	err = json.NewDecoder(res.Body).Decode(tsub)
-	if err != nil && err != io.EOF {
+	err = cs.Kafka.decode(res, tsub)
+	if err != nil {
 		return nil, err
 	}
 
@@ -331,6 +403,11 @@ func (cs *Consumers) Subscriptions(consumerName string, consumerGroup ...string)
 
 // Unsubscribe from topics currently subscribed.
 func (cs *Consumers) Unsubscribe(consumerName string, consumerGroup ...string) error {
+	return cs.UnsubscribeContext(context.Background(), consumerName, consumerGroup...)
+}
+
+// UnsubscribeContext is like Unsubscribe but with a context.
+func (cs *Consumers) UnsubscribeContext(ctx context.Context, consumerName string, consumerGroup ...string) error {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return err
@@ -341,8 +418,9 @@ func (cs *Consumers) Unsubscribe(consumerName string, consumerGroup ...string) e
 	if err != nil {
 		return err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "DELETE /consumers/{group}/instances/{instance}/subscription", Group: cg, Instance: consumerName, Partition: -1})
 
-	req, err := http.NewRequest("DELETE", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return err
 	}
@@ -359,11 +437,19 @@ func (cs *Consumers) Unsubscribe(consumerName string, consumerGroup ...string) e
 		return err
 	}
 
+	cs.Kafka.logger().LogAttrs(ctx, slog.LevelInfo, "kafka: unsubscribed",
+		slog.String("group", cg), slog.String("instance", consumerName))
+
 	return nil
 }
 
 // Assign manually assign a list of partitions to this consumer.
 func (cs *Consumers) Assign(consumerOffsetsPartitions *ConsumerOffsetsPartitions, consumerName string, consumerGroup ...string) error {
+	return cs.AssignContext(context.Background(), consumerOffsetsPartitions, consumerName, consumerGroup...)
+}
+
+// AssignContext is like Assign but with a context.
+func (cs *Consumers) AssignContext(ctx context.Context, consumerOffsetsPartitions *ConsumerOffsetsPartitions, consumerName string, consumerGroup ...string) error {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return err
@@ -374,11 +460,12 @@ func (cs *Consumers) Assign(consumerOffsetsPartitions *ConsumerOffsetsPartitions
 	if err != nil {
 		return err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "POST /consumers/{group}/instances/{instance}/assignments", Group: cg, Instance: consumerName, Partition: -1})
 
 	b := &bytes.Buffer{}
 	json.NewEncoder(b).Encode(consumerOffsetsPartitions)
 
-	req, err := http.NewRequest("POST", url, b)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, b)
 	if err != nil {
 		return err
 	}
@@ -396,11 +483,19 @@ func (cs *Consumers) Assign(consumerOffsetsPartitions *ConsumerOffsetsPartitions
 		return err
 	}
 
+	cs.Kafka.logger().LogAttrs(ctx, slog.LevelInfo, "kafka: partitions assigned",
+		slog.String("group", cg), slog.String("instance", consumerName), slog.Any("partitions", consumerOffsetsPartitions.Partitions))
+
 	return nil
 }
 
 // Assignments get the list of partitions currently manually assigned to this consumer.
 func (cs *Consumers) Assignments(consumerName string, consumerGroup ...string) (*ConsumerOffsetsPartitions, error) {
+	return cs.AssignmentsContext(context.Background(), consumerName, consumerGroup...)
+}
+
+// AssignmentsContext is like Assignments but with a context.
+func (cs *Consumers) AssignmentsContext(ctx context.Context, consumerName string, consumerGroup ...string) (*ConsumerOffsetsPartitions, error) {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return nil, err
@@ -411,8 +506,9 @@ func (cs *Consumers) Assignments(consumerName string, consumerGroup ...string) (
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /consumers/{group}/instances/{instance}/assignments", Group: cg, Instance: consumerName, Partition: -1})
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -431,8 +527,8 @@ func (cs *Consumers) Assignments(consumerName string, consumerGroup ...string) (
 
 	cofp := &ConsumerOffsetsPartitions{}
 
-	err = json.NewDecoder(res.Body).Decode(cofp)
-	if err != nil && err != io.EOF {
+	err = cs.Kafka.decode(res, cofp)
+	if err != nil {
 		return nil, err
 	}
 
@@ -441,6 +537,11 @@ func (cs *Consumers) Assignments(consumerName string, consumerGroup ...string) (
 
 // Seek overrides the fetch offsets that the consumer will use for the next set of records to fetch.
 func (cs *Consumers) Seek(consumerOffsets *ConsumerOffsets, consumerName string, consumerGroup ...string) error {
+	return cs.SeekContext(context.Background(), consumerOffsets, consumerName, consumerGroup...)
+}
+
+// SeekContext is like Seek but with a context.
+func (cs *Consumers) SeekContext(ctx context.Context, consumerOffsets *ConsumerOffsets, consumerName string, consumerGroup ...string) error {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return err
@@ -451,11 +552,12 @@ func (cs *Consumers) Seek(consumerOffsets *ConsumerOffsets, consumerName string,
 	if err != nil {
 		return err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "POST /consumers/{group}/instances/{instance}/positions", Group: cg, Instance: consumerName, Partition: -1})
 
 	b := &bytes.Buffer{}
 	json.NewEncoder(b).Encode(consumerOffsets)
 
-	req, err := http.NewRequest("POST", url, b)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, b)
 	if err != nil {
 		return err
 	}
@@ -478,6 +580,11 @@ func (cs *Consumers) Seek(consumerOffsets *ConsumerOffsets, consumerName string,
 
 // SeekToBeginning seek to the first offset for each of the given partitions.
 func (cs *Consumers) SeekToBeginning(consumerOffsetsPartitions *ConsumerOffsetsPartitions, consumerName string, consumerGroup ...string) error {
+	return cs.SeekToBeginningContext(context.Background(), consumerOffsetsPartitions, consumerName, consumerGroup...)
+}
+
+// SeekToBeginningContext is like SeekToBeginning but with a context.
+func (cs *Consumers) SeekToBeginningContext(ctx context.Context, consumerOffsetsPartitions *ConsumerOffsetsPartitions, consumerName string, consumerGroup ...string) error {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return err
@@ -488,11 +595,12 @@ func (cs *Consumers) SeekToBeginning(consumerOffsetsPartitions *ConsumerOffsetsP
 	if err != nil {
 		return err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "POST /consumers/{group}/instances/{instance}/positions/beginning", Group: cg, Instance: consumerName, Partition: -1})
 
 	b := &bytes.Buffer{}
 	json.NewEncoder(b).Encode(consumerOffsetsPartitions)
 
-	req, err := http.NewRequest("POST", url, b)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, b)
 	if err != nil {
 		return err
 	}
@@ -515,6 +623,11 @@ func (cs *Consumers) SeekToBeginning(consumerOffsetsPartitions *ConsumerOffsetsP
 
 // SeekToEnd seek to the last offset for each of the given partitions.
 func (cs *Consumers) SeekToEnd(consumerOffsetsPartitions *ConsumerOffsetsPartitions, consumerName string, consumerGroup ...string) error {
+	return cs.SeekToEndContext(context.Background(), consumerOffsetsPartitions, consumerName, consumerGroup...)
+}
+
+// SeekToEndContext is like SeekToEnd but with a context.
+func (cs *Consumers) SeekToEndContext(ctx context.Context, consumerOffsetsPartitions *ConsumerOffsetsPartitions, consumerName string, consumerGroup ...string) error {
 	cg, err := getConsumerGroup(cs, consumerGroup)
 	if err != nil {
 		return err
@@ -525,11 +638,12 @@ func (cs *Consumers) SeekToEnd(consumerOffsetsPartitions *ConsumerOffsetsPartiti
 	if err != nil {
 		return err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "POST /consumers/{group}/instances/{instance}/positions/end", Group: cg, Instance: consumerName, Partition: -1})
 
 	b := &bytes.Buffer{}
 	json.NewEncoder(b).Encode(consumerOffsetsPartitions)
 
-	req, err := http.NewRequest("POST", url, b)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, b)
 	if err != nil {
 		return err
 	}
@@ -555,6 +669,19 @@ func (cs *Consumers) SeekToEnd(consumerOffsetsPartitions *ConsumerOffsetsPartiti
 // Timeout is the number of milliseconds for the underlying request to fetch the records. Default to 5000ms.
 // MaxBytes is the maximum number of bytes of unencoded keys and values that should be included in the response. Default is unlimited.
 func (cs *Consumers) Records(recordsArg Argument) ([]Message, error) {
+	return cs.RecordsContext(context.Background(), recordsArg)
+}
+
+// RecordsContext is like Records but with a context.
+func (cs *Consumers) RecordsContext(ctx context.Context, recordsArg Argument) ([]Message, error) {
+	m, err := cs.records(ctx, recordsArg)
+	cg, _ := getConsumerGroup(cs, []string{recordsArg.ConsumerGroup})
+	cs.Kafka.metrics().Fetched(cg, m, err)
+	cs.Kafka.logFetched(ctx, cg, m, err)
+	return m, err
+}
+
+func (cs *Consumers) records(ctx context.Context, recordsArg Argument) ([]Message, error) {
 	timeout := recordsArg.Timeout
 	maxBytes := recordsArg.MaxBytes
 	consumerName := recordsArg.ConsumerName
@@ -574,8 +701,9 @@ func (cs *Consumers) Records(recordsArg Argument) ([]Message, error) {
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /consumers/{group}/instances/{instance}/records", Group: cg, Instance: consumerName, Partition: -1})
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -606,8 +734,8 @@ func (cs *Consumers) Records(recordsArg Argument) ([]Message, error) {
 
 	m := []Message{}
 
-	err = json.NewDecoder(res.Body).Decode(m)
-	if err != nil && err != io.EOF {
+	err = cs.Kafka.decode(res, &m)
+	if err != nil {
 		return nil, err
 	}
 
@@ -618,6 +746,19 @@ func (cs *Consumers) Records(recordsArg Argument) ([]Message, error) {
 // Messages arguments include MaxBytes (optional) TopicName ConsumerName  ConsumerGroup.
 // MaxBytes is the maximum number of bytes of unencoded keys and values that should be included in the response. Default is unlimited.
 func (cs *Consumers) Messages(messagesArg Argument) ([]Message, error) {
+	return cs.MessagesContext(context.Background(), messagesArg)
+}
+
+// MessagesContext is like Messages but with a context.
+func (cs *Consumers) MessagesContext(ctx context.Context, messagesArg Argument) ([]Message, error) {
+	m, err := cs.messages(ctx, messagesArg)
+	cg, _ := getConsumerGroup(cs, []string{messagesArg.ConsumerGroup})
+	cs.Kafka.metrics().Fetched(cg, m, err)
+	cs.Kafka.logFetched(ctx, cg, m, err)
+	return m, err
+}
+
+func (cs *Consumers) messages(ctx context.Context, messagesArg Argument) ([]Message, error) {
 	topicName := messagesArg.TopicName
 	maxBytes := messagesArg.MaxBytes
 	consumerName := messagesArg.ConsumerName
@@ -632,13 +773,18 @@ func (cs *Consumers) Messages(messagesArg Argument) ([]Message, error) {
 		return nil, err
 	}
 
+	if err := ValidateTopicName(topicName); err != nil {
+		return nil, err
+	}
+
 	client := cs.Kafka.HTTPClient()
 	url, err := URLJoin(cs.Kafka.URL, "consumers", cg, "instances", consumerName, "topics", topicName)
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /consumers/{group}/instances/{instance}/topics/{topic}", Topic: topicName, Group: cg, Instance: consumerName, Partition: -1})
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -664,50 +810,185 @@ func (cs *Consumers) Messages(messagesArg Argument) ([]Message, error) {
 
 	m := []Message{}
 
-	err = json.NewDecoder(res.Body).Decode(m)
-	if err != nil && err != io.EOF {
+	err = cs.Kafka.decode(res, &m)
+	if err != nil {
 		return nil, err
 	}
 
 	return m, nil
 }
 
-// Poll keep polling messages from a topic.
-// the interval to poll messages is every interval ms, onMessage to handle polled messages.
-// returned func is for cancellation.
-func (cs *Consumers) Poll(interval time.Duration, messagesArg Argument, onMessage func(error, []Message)) func() {
+// Poll keeps polling messages until ctx is done or the returned func is called.
+// It fetches from messagesArg.TopicName via API v1 or from the subscribed topics via API v2.
+// Messages are fetched back to back while they keep coming, after an empty batch the next fetch waits for interval,
+// default to 1s if not positive. onMessage handles each non-empty batch of polled messages, or the error of a failed fetch.
+// Polling carries on with exponential backoff after transient errors, e.g. 5xx responses,
+// it stops after other errors, e.g. 40403 consumer instance not found.
+// The returned func cancels polling and waits for it to stop, it must not be called from onMessage.
+func (cs *Consumers) Poll(ctx context.Context, interval time.Duration, messagesArg Argument, onMessage func(error, []Message)) func() {
+	if interval <= 0 {
+		interval = defaultIdleInterval
+	}
 
-	timedout := make(chan struct{})
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
 	cancelFunc := func() {
-		close(timedout)
+		cancel()
+		<-done
 	}
 
 	go func() {
-		t := time.NewTicker((time.Duration(interval) * time.Millisecond))
-		var messages []Message
-		var err error
+		defer close(done)
+		bo := newBackoff()
 		for {
-			select {
-			case <-timedout:
-				t.Stop()
+			messages, err := cs.fetch(ctx, messagesArg)
+			if ctx.Err() != nil {
 				return
-			case <-t.C:
-				break
 			}
 
-			if cs.Kafka.Version == V1 {
-				messages, err = cs.Messages(messagesArg)
-			} else {
-				messages, err = cs.Records(messagesArg)
+			var wait time.Duration
+			switch {
+			case err != nil && !isRetriable(err):
+				onMessage(err, nil)
+				return
+			case err != nil:
+				onMessage(err, nil)
+				wait = bo.next()
+				cs.Kafka.retry(ctx, "fetch", err, slog.Duration("backoff", wait))
+			case len(messages) == 0:
+				bo.reset()
+				wait = interval
+			default:
+				bo.reset()
+				onMessage(nil, messages)
 			}
 
-			if err != nil {
-				onMessage(err, nil)
+			if !sleepContext(ctx, wait) {
 				return
 			}
-			onMessage(nil, messages)
 		}
 	}()
 
 	return cancelFunc
 }
+
+// Stream keeps polling messages like Poll until ctx is done, and sends them one by one on the returned message channel.
+// After an empty batch the next fetch waits for interval, default to 1s if not positive.
+// Fetched batches are buffered up to bufferSize messages (optional), default to 100, unbuffered if negative,
+// fetching pauses while the buffer is full.
+// Errors of failed fetches are sent on the returned error channel, polling pauses until they are received.
+// Both channels are closed after ctx is done, or after an error which stops polling.
+func (cs *Consumers) Stream(ctx context.Context, interval time.Duration, messagesArg Argument, bufferSize ...int) (<-chan Message, <-chan error) {
+	size := defaultStreamBuffer
+	if len(bufferSize) > 0 {
+		size = bufferSize[0]
+	}
+	if size < 0 {
+		size = 0
+	}
+
+	messages := make(chan Message, size)
+	errs := make(chan error)
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	go func() {
+		defer close(errs)
+		defer close(messages)
+		defer cancel()
+
+		cancelFunc := cs.Poll(ctx, interval, messagesArg, func(err error, batch []Message) {
+			if err != nil {
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+				}
+				if !isRetriable(err) {
+					cancel()
+				}
+				return
+			}
+
+			for _, m := range batch {
+				select {
+				case messages <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+
+		<-ctx.Done()
+		cancelFunc()
+	}()
+
+	return messages, errs
+}
+
+// KeepAlive keeps the consumer instance from expiring after consumer.instance.timeout.ms of inactivity,
+// e.g. while fetching pauses for backpressure, by getting its subscriptions every interval via API v2,
+// until ctx is done or the returned func is called. interval must be shorter than the instance timeout.
+// onExpired is called if the instance is found expired anyway, after which KeepAlive stops.
+// Other errors are ignored and the call is retried on the next interval.
+// The returned func cancels KeepAlive and waits for it to stop, it must not be called from onExpired.
+func (cs *Consumers) KeepAlive(ctx context.Context, interval time.Duration, consumerName string, onExpired func(error), consumerGroup ...string) (func(), error) {
+	if cs.Kafka.Version == V1 {
+		return nil, errors.New("Error: KeepAlive requires API v2")
+	}
+
+	if interval <= 0 {
+		return nil, errors.New("Error: invalid interval")
+	}
+
+	if consumerName == "" {
+		return nil, errors.New("Error: empty ConsumerName")
+	}
+
+	cg, err := getConsumerGroup(cs, consumerGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	cancelFunc := func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+
+			_, err := cs.SubscriptionsContext(ctx, consumerName, cg)
+			switch {
+			case IsConsumerInstanceNotFound(err):
+				cs.Kafka.logger().LogAttrs(ctx, slog.LevelWarn, "kafka: consumer instance expired",
+					slog.String("group", cg), slog.String("instance", consumerName))
+				if onExpired != nil {
+					onExpired(err)
+				}
+				return
+			case err != nil && ctx.Err() == nil:
+				cs.Kafka.retry(ctx, "keep_alive", err, slog.String("group", cg), slog.String("instance", consumerName))
+			}
+		}
+	}()
+
+	return cancelFunc, nil
+}
+
+// fetch calls Messages or Records depending on the API version.
+func (cs *Consumers) fetch(ctx context.Context, arg Argument) ([]Message, error) {
+	if cs.Kafka.Version == V1 {
+		return cs.MessagesContext(ctx, arg)
+	}
+	return cs.RecordsContext(ctx, arg)
+}
@@ -0,0 +1,223 @@
+package kafka
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// Dispatcher processes messages concurrently on a pool of workers.
+	// Messages are routed to workers by topic partition, or by message key if ByKey is set,
+	// so that messages of the same partition (or key) are handled one at a time in order,
+	// while different partitions are handled in parallel.
+	Dispatcher struct {
+		// Workers is the number of worker goroutines. Default to 8.
+		Workers int
+		// QueueDepth is the number of messages queued per worker before dispatching blocks. Default to 100.
+		QueueDepth int
+		// ByKey routes by message key instead of topic partition, messages without key are routed by topic partition.
+		ByKey bool
+		// Tracker (optional) tracks messages dispatched by Run, they are marked done once handled without error.
+		Tracker *OffsetTracker
+		// OnError (optional) is called for messages dispatched by Run which handler fails on,
+		// such messages are never marked done so the committed offset does not move past them.
+		OnError func(Message, error)
+
+		handler func(context.Context, Message) error
+		queues  []chan dispatchJob
+		wg      sync.WaitGroup
+	}
+
+	dispatchJob struct {
+		ctx     context.Context
+		message Message
+		done    func(error)
+	}
+)
+
+const (
+	defaultWorkers    = 8
+	defaultQueueDepth = 100
+)
+
+// NewDispatcher returns a Dispatcher instance with its workers started,
+// options are applied in order before the workers start.
+func NewDispatcher(handler func(context.Context, Message) error, options ...func(*Dispatcher) error) (*Dispatcher, error) {
+	if handler == nil {
+		return nil, errors.New("Error: nil handler")
+	}
+
+	d := Dispatcher{
+		Workers:    defaultWorkers,
+		QueueDepth: defaultQueueDepth,
+		handler:    handler,
+	}
+
+	for _, opt := range options {
+		if err := opt(&d); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.Workers <= 0 {
+		return nil, errors.New("Error: Workers must be positive")
+	}
+	if d.QueueDepth < 0 {
+		return nil, errors.New("Error: QueueDepth must not be negative")
+	}
+
+	d.queues = make([]chan dispatchJob, d.Workers)
+	for i := range d.queues {
+		d.queues[i] = make(chan dispatchJob, d.QueueDepth)
+		d.wg.Add(1)
+		go d.work(d.queues[i])
+	}
+
+	return &d, nil
+}
+
+// SetWorkers applies Workers to Dispatcher.
+func SetWorkers(workers int) func(*Dispatcher) error {
+	return func(d *Dispatcher) error {
+		d.Workers = workers
+		return nil
+	}
+}
+
+// SetQueueDepth applies QueueDepth to Dispatcher.
+func SetQueueDepth(queueDepth int) func(*Dispatcher) error {
+	return func(d *Dispatcher) error {
+		d.QueueDepth = queueDepth
+		return nil
+	}
+}
+
+// KeyOrdering set Dispatcher to route messages by key.
+func KeyOrdering(d *Dispatcher) error {
+	d.ByKey = true
+	return nil
+}
+
+// SetTracker applies Tracker to Dispatcher.
+func SetTracker(tracker *OffsetTracker) func(*Dispatcher) error {
+	return func(d *Dispatcher) error {
+		d.Tracker = tracker
+		return nil
+	}
+}
+
+// SetOnError applies OnError to Dispatcher.
+func SetOnError(onError func(Message, error)) func(*Dispatcher) error {
+	return func(d *Dispatcher) error {
+		d.OnError = onError
+		return nil
+	}
+}
+
+// Handle dispatches a batch of messages and waits until all of them are handled.
+// It returns the first handler error, if any, so it can be used as the handler of ManagedConsumer.Run.
+func (d *Dispatcher) Handle(ctx context.Context, messages []Message) error {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	done := func(err error) {
+		if err != nil {
+			once.Do(func() { firstErr = err })
+		}
+		wg.Done()
+	}
+
+	for _, m := range messages {
+		wg.Add(1)
+		if !d.dispatch(ctx, m, done) {
+			wg.Done()
+			wg.Wait()
+			return ctx.Err()
+		}
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// Run dispatches messages received from the channel, e.g. returned by Consumers.Stream,
+// until it is closed or ctx is done, then it waits for the dispatched messages to be handled.
+// Run returns ctx.Err() on cancellation.
+func (d *Dispatcher) Run(ctx context.Context, messages <-chan Message) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		var m Message
+		var ok bool
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m, ok = <-messages:
+			if !ok {
+				return nil
+			}
+		}
+
+		if d.Tracker != nil {
+			d.Tracker.Track(m)
+		}
+
+		msg := m
+		wg.Add(1)
+		done := func(err error) {
+			defer wg.Done()
+			switch {
+			case err != nil && d.OnError != nil:
+				d.OnError(msg, err)
+			case err == nil && d.Tracker != nil:
+				d.Tracker.Done(msg)
+			}
+		}
+
+		if !d.dispatch(ctx, m, done) {
+			wg.Done()
+			return ctx.Err()
+		}
+	}
+}
+
+// Close stops the workers after the queued messages are handled,
+// messages must not be dispatched after Close is called.
+func (d *Dispatcher) Close() {
+	for _, q := range d.queues {
+		close(q)
+	}
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, m Message, done func(error)) bool {
+	select {
+	case d.queues[d.route(m)] <- dispatchJob{ctx: ctx, message: m, done: done}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (d *Dispatcher) route(m Message) int {
+	h := fnv.New32a()
+	if d.ByKey && len(m.Key) > 0 && string(m.Key) != "null" {
+		h.Write(m.Key)
+	} else {
+		h.Write([]byte(m.Topic + "/" + strconv.Itoa(m.Partition)))
+	}
+	return int(h.Sum32() % uint32(len(d.queues)))
+}
+
+func (d *Dispatcher) work(queue <-chan dispatchJob) {
+	defer d.wg.Done()
+	for j := range queue {
+		j.done(d.handler(j.ctx, j.message))
+	}
+}
@@ -0,0 +1,33 @@
+package kafka
+
+import (
+	"context"
+)
+
+type (
+	// Endpoint describes the API call a request is made for, so that a Transport can instrument
+	// or limit requests per call rather than per URL. It is set on the context of every request.
+	Endpoint struct {
+		// Name is the route template, e.g. "POST /topics/{topic}"
+		Name string
+		// Topic, Group and Instance are the path parameters of the call, if any
+		Topic    string
+		Group    string
+		Instance string
+		// Partition is the partition path parameter of the call, -1 if none
+		Partition int
+	}
+
+	endpointKey struct{}
+)
+
+// EndpointFrom returns the Endpoint of the request context ctx, false if it is not a request of this package.
+func EndpointFrom(ctx context.Context) (Endpoint, bool) {
+	e, ok := ctx.Value(endpointKey{}).(Endpoint)
+	return e, ok
+}
+
+// withEndpoint returns ctx with the Endpoint e.
+func withEndpoint(ctx context.Context, e Endpoint) context.Context {
+	return context.WithValue(ctx, endpointKey{}, e)
+}
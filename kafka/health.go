@@ -0,0 +1,165 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+type (
+	// HealthReport is the cluster health computed from the partition replica metadata
+	HealthReport struct {
+		Topics     int `json:"topics"`
+		Partitions int `json:"partitions"`
+		// UnderReplicated are the partitions with replicas out of sync
+		UnderReplicated []PartitionHealth `json:"under_replicated"`
+		// Offline are the partitions without leader
+		Offline []PartitionHealth `json:"offline"`
+		// BelowMinInSync are the partitions with fewer in-sync replicas than min.insync.replicas of the topic
+		BelowMinInSync []PartitionHealth `json:"below_min_insync"`
+		// Brokers are the partition leaders and replicas per broker
+		Brokers []BrokerHealth `json:"brokers"`
+		// IdleBrokers are the brokers which host no partition
+		IdleBrokers []int `json:"idle_brokers"`
+	}
+
+	// PartitionHealth is the replica state of a partition
+	PartitionHealth struct {
+		Topic     string `json:"topic"`
+		Partition int    `json:"partition"`
+		Leader    int    `json:"leader"`
+		Replicas  int    `json:"replicas"`
+		InSync    int    `json:"in_sync"`
+		MinInSync int    `json:"min_insync"`
+	}
+
+	// BrokerHealth is the partition leadership of a broker
+	BrokerHealth struct {
+		Broker   int `json:"broker"`
+		Leaders  int `json:"leaders"`
+		Replicas int `json:"replicas"`
+		// LeaderSkew is the ratio of Leaders to the average number of leaders per broker, 1 is balanced
+		LeaderSkew float64 `json:"leader_skew"`
+	}
+)
+
+// Health scans all the topics and reports under-replicated, offline and below min.insync.replicas partitions,
+// leader skew per broker and brokers hosting no partition. The metadata cache of Kafka is refreshed.
+func (k *Kafka) Health(ctx context.Context) (*HealthReport, error) {
+	broker, err := k.BrokerContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	md := k.Metadata()
+	md.Invalidate()
+	topics, err := md.Topics(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return healthReport(broker.Brokers, topics), nil
+}
+
+// Healthy reports whether all the partitions have a leader and enough in-sync replicas.
+func (h *HealthReport) Healthy() bool {
+	return len(h.Offline) == 0 && len(h.BelowMinInSync) == 0
+}
+
+func healthReport(brokers []int, topics []Topic) *HealthReport {
+	h := &HealthReport{
+		Topics:          len(topics),
+		UnderReplicated: []PartitionHealth{},
+		Offline:         []PartitionHealth{},
+		BelowMinInSync:  []PartitionHealth{},
+		Brokers:         []BrokerHealth{},
+		IdleBrokers:     []int{},
+	}
+
+	byBroker := make(map[int]*BrokerHealth)
+	for _, b := range brokers {
+		byBroker[b] = &BrokerHealth{Broker: b}
+	}
+	brokerHealth := func(b int) *BrokerHealth {
+		bh, ok := byBroker[b]
+		if !ok {
+			bh = &BrokerHealth{Broker: b}
+			byBroker[b] = bh
+		}
+		return bh
+	}
+
+	leaders := 0
+	for _, t := range topics {
+		minInSync := minInSyncReplicas(t.Configs)
+		for _, p := range t.Partitions {
+			h.Partitions++
+
+			ph := PartitionHealth{
+				Topic:     t.Name,
+				Partition: p.Partition,
+				Leader:    p.Leader,
+				Replicas:  len(p.Replicas),
+				MinInSync: minInSync,
+			}
+			for _, r := range p.Replicas {
+				brokerHealth(r.Broker).Replicas++
+				if r.InSync {
+					ph.InSync++
+				}
+			}
+
+			if p.Leader < 0 {
+				h.Offline = append(h.Offline, ph)
+			} else {
+				brokerHealth(p.Leader).Leaders++
+				leaders++
+			}
+			if ph.InSync < ph.Replicas {
+				h.UnderReplicated = append(h.UnderReplicated, ph)
+			}
+			if len(p.Replicas) > 0 && ph.InSync < minInSync {
+				h.BelowMinInSync = append(h.BelowMinInSync, ph)
+			}
+		}
+	}
+
+	average := 0.0
+	if len(byBroker) > 0 {
+		average = float64(leaders) / float64(len(byBroker))
+	}
+	for _, bh := range byBroker {
+		if average > 0 {
+			bh.LeaderSkew = float64(bh.Leaders) / average
+		}
+		h.Brokers = append(h.Brokers, *bh)
+		if bh.Replicas == 0 {
+			h.IdleBrokers = append(h.IdleBrokers, bh.Broker)
+		}
+	}
+	sort.Slice(h.Brokers, func(i, j int) bool { return h.Brokers[i].Broker < h.Brokers[j].Broker })
+	sort.Ints(h.IdleBrokers)
+
+	return h
+}
+
+// minInSyncReplicas returns min.insync.replicas from the topic configs, default to 1.
+func minInSyncReplicas(configs json.RawMessage) int {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(configs, &cfg); err != nil {
+		return 1
+	}
+
+	v, ok := cfg["min.insync.replicas"]
+	if !ok || v == nil {
+		return 1
+	}
+
+	n, err := strconv.Atoi(fmt.Sprint(v))
+	if err != nil || n < 1 {
+		return 1
+	}
+	return n
+}
@@ -4,14 +4,18 @@ package kafka
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"mime"
 	"net/http"
 	"net/url"
-	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -27,6 +31,32 @@ type (
 		Format      Format
 		Offset      Offset
 		Version     Version
+		// MetadataTTL is how long cached metadata is fresh, caching is disabled if 0
+		MetadataTTL time.Duration
+		// Transport makes the requests, http.DefaultTransport if nil
+		Transport http.RoundTripper `json:"-"`
+		// MaxResponseBytes limits the size of decoded response bodies, unlimited if 0
+		MaxResponseBytes int64
+		// Metrics (optional) is notified of requests, produces, fetches, commits and lag
+		Metrics Metrics `json:"-"`
+		// Logger (optional) logs requests, retries, consumer instances, subscriptions and commits
+		Logger *slog.Logger `json:"-"`
+		// LogPayloads logs the records produced and fetched, which are redacted by default
+		LogPayloads bool
+		// Limits are the client-side rate and concurrency limits of requests per EndpointClass,
+		// they are read on the first request
+		Limits map[EndpointClass]Limit
+		// MaxThrottleRetries is how many times a request throttled with status 429 is retried after Retry-After
+		MaxThrottleRetries int
+		// CircuitBreaker (optional) fails requests fast with ErrCircuitOpen while an endpoint of the REST proxy is degraded,
+		// it is read on the first request
+		CircuitBreaker *CircuitBreaker `json:"-"`
+
+		// mu guards the state of Kafka created on first use, it is created by New
+		mu       *sync.Mutex
+		metadata *Metadata
+		limits   *limiters
+		circuits *breakers
 	}
 
 	kafkaInterface interface {
@@ -52,6 +82,19 @@ type (
 		ErrorCode int    `json:"error_code,omitempty"`
 		Message   string `json:"message,omitempty"`
 	}
+
+	// APIError is returned when the API responds with an unexpected status code
+	APIError struct {
+		StatusCode int
+		Status     string
+		ErrorMessage
+		Body string
+	}
+
+	// responseError is an invalid, truncated or oversized response body.
+	responseError struct {
+		error
+	}
 )
 
 const (
@@ -77,23 +120,61 @@ const (
 
 	// V1 is API v1
 	V1 = Version("v1")
+
+	// ErrCodeTopicNotFound is the error code for a topic which does not exist
+	ErrCodeTopicNotFound = 40401
+	// ErrCodePartitionNotFound is the error code for a partition which does not exist
+	ErrCodePartitionNotFound = 40402
+	// ErrCodeConsumerInstanceNotFound is the error code for a consumer instance which does not exist or has expired
+	ErrCodeConsumerInstanceNotFound = 40403
+	// ErrCodeRetriableKafka is the error code for a retriable Kafka error, e.g. leader not available
+	ErrCodeRetriableKafka = 50003
+
+	// ProducerErrCodeRetriable is the ProducerOffsets error code for a retriable Kafka error
+	ProducerErrCodeRetriable = 2
+
+	// maxTopicNameLength is the maximum length of Kafka topic names
+	maxTopicNameLength = 249
+	// maxErrorBody is the maximum size of error response bodies read, and of bodies drained on close
+	maxErrorBody = 64 << 10
 )
 
 // Defaults for Kafka
 var Defaults = Kafka{
-	URL:         "http://localhost:8082",
-	Timeout:     60 * time.Second,
-	Accept:      "application/vnd.kafka+json, application/json",
-	ContentType: "application/vnd.kafka+json",
-	Format:      Binary,
-	Offset:      Largest,
-	Version:     V1,
+	URL:                "http://localhost:8082",
+	Timeout:            60 * time.Second,
+	Accept:             "application/vnd.kafka+json, application/json",
+	ContentType:        "application/vnd.kafka+json",
+	Format:             Binary,
+	Offset:             Largest,
+	Version:            V1,
+	MetadataTTL:        time.Minute,
+	MaxResponseBytes:   64 << 20,
+	MaxThrottleRetries: 2,
 }
 
-// HTTPClient creates a new http.Client with timeout.
+// HTTPClient creates a new http.Client with timeout and transport, measuring requests if Metrics is set,
+// logging them if Logger is set, limiting them to Limits and Retry-After of throttled requests,
+// and failing them fast while the circuit of their endpoint is open if CircuitBreaker is set.
 func (k *Kafka) HTTPClient() *http.Client {
+	transport := k.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if k.Metrics != nil {
+		transport = &metricsTransport{metrics: k.Metrics, base: transport}
+	}
+	if k.Logger != nil {
+		transport = &loggingTransport{logger: k.Logger, base: transport}
+	}
+	transport = &limitTransport{kafka: k, base: transport}
+	if k.CircuitBreaker != nil {
+		transport = &breakerTransport{kafka: k, base: transport}
+	}
+
 	var netClient = &http.Client{
-		Timeout: k.Timeout,
+		Timeout:   k.Timeout,
+		Transport: transport,
 	}
 	return netClient
 }
@@ -194,6 +275,30 @@ func SetContentType(contentType string) func(*Kafka) error {
 	}
 }
 
+// SetMetadataTTL applies MetadataTTL to Kafka.
+func SetMetadataTTL(ttl time.Duration) func(*Kafka) error {
+	return func(k *Kafka) error {
+		k.MetadataTTL = ttl
+		return nil
+	}
+}
+
+// SetTransport applies Transport to Kafka.
+func SetTransport(transport http.RoundTripper) func(*Kafka) error {
+	return func(k *Kafka) error {
+		k.Transport = transport
+		return nil
+	}
+}
+
+// SetMaxResponseBytes applies MaxResponseBytes to Kafka.
+func SetMaxResponseBytes(maxResponseBytes int64) func(*Kafka) error {
+	return func(k *Kafka) error {
+		k.MaxResponseBytes = maxResponseBytes
+		return nil
+	}
+}
+
 func applyDefaults(k *Kafka) {
 	k.URL = Defaults.URL
 	k.Timeout = Defaults.Timeout
@@ -202,6 +307,15 @@ func applyDefaults(k *Kafka) {
 	k.Format = Defaults.Format
 	k.Offset = Defaults.Offset
 	k.Version = Defaults.Version
+	k.MetadataTTL = Defaults.MetadataTTL
+	k.Transport = Defaults.Transport
+	k.MaxResponseBytes = Defaults.MaxResponseBytes
+	k.Metrics = Defaults.Metrics
+	k.Logger = Defaults.Logger
+	k.LogPayloads = Defaults.LogPayloads
+	k.Limits = Defaults.Limits
+	k.MaxThrottleRetries = Defaults.MaxThrottleRetries
+	k.CircuitBreaker = Defaults.CircuitBreaker
 }
 
 func validateStatusCode(res *http.Response, expectedStatusCode ...int) error {
@@ -211,21 +325,122 @@ func validateStatusCode(res *http.Response, expectedStatusCode ...int) error {
 	}
 
 	if res.StatusCode != code {
-		errMsg := &ErrorMessage{}
-		err := json.NewDecoder(res.Body).Decode(errMsg)
-		if err != nil && err != io.EOF {
-			body, _ := ioutil.ReadAll(res.Body)
-			return errors.Wrap(errors.New("API Error"), string(body))
+		apiErr := &APIError{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
 		}
-		return errors.Wrap(errors.New("API Error"),
-			fmt.Sprintf("StatusCode %v %v ErrorCode %v %v", res.StatusCode, res.Status, errMsg.ErrorCode, errMsg.Message))
+		// the whole body is read first, so that it is kept as is if it is not an ErrorMessage
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+		if len(bytes.TrimSpace(body)) > 0 && json.Unmarshal(body, &apiErr.ErrorMessage) != nil {
+			apiErr.Body = string(body)
+		}
+		return apiErr
+	}
+	return nil
+}
+
+// decode decodes the JSON response body into v. The body must be non-empty, complete, of a JSON media type,
+// and at most MaxResponseBytes long if it is positive.
+func (k *Kafka) decode(res *http.Response, v interface{}) error {
+	if err := k.decodeBody(res, v); err != nil {
+		return &responseError{err}
 	}
 	return nil
 }
 
+func (k *Kafka) decodeBody(res *http.Response, v interface{}) error {
+	contentType := res.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != "application/json" && !strings.HasSuffix(mediaType, "+json")) {
+		return errors.Errorf("Error: unexpected Content-Type %q of response", contentType)
+	}
+
+	var r io.Reader = res.Body
+	if k.MaxResponseBytes > 0 {
+		r = io.LimitReader(res.Body, k.MaxResponseBytes+1)
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		return errors.Wrap(err, "Error: read response")
+	}
+
+	switch {
+	case k.MaxResponseBytes > 0 && int64(len(body)) > k.MaxResponseBytes:
+		return errors.Errorf("Error: response exceeds %d bytes", k.MaxResponseBytes)
+	case len(bytes.TrimSpace(body)) == 0:
+		return errors.New("Error: empty response")
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return errors.Wrap(err, "Error: invalid or truncated response")
+	}
+	return nil
+}
+
+// Unwrap returns the decoding error.
+func (e *responseError) Unwrap() error {
+	return e.error
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	if e.Body != "" {
+		return e.Body + ": API Error"
+	}
+	return fmt.Sprintf("StatusCode %v %v ErrorCode %v %v: API Error", e.StatusCode, e.Status, e.ErrorCode, e.Message)
+}
+
+// IsConsumerInstanceNotFound reports whether err is caused by a consumer instance
+// which does not exist, e.g. expired after consumer.instance.timeout.ms of inactivity.
+func IsConsumerInstanceNotFound(err error) bool {
+	apiErr, ok := errors.Cause(err).(*APIError)
+	return ok && apiErr.ErrorCode == ErrCodeConsumerInstanceNotFound
+}
+
+// IsTopicNotFound reports whether err is caused by a topic which does not exist.
+func IsTopicNotFound(err error) bool {
+	apiErr, ok := errors.Cause(err).(*APIError)
+	return ok && apiErr.ErrorCode == ErrCodeTopicNotFound
+}
+
+// isRetriable reports whether err is likely transient: the request got no response, a 429 or 5xx response,
+// an invalid or truncated response body, or it was failed fast by an open CircuitBreaker.
+func isRetriable(err error) bool {
+	if apiErr, ok := errors.Cause(err).(*APIError); ok {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var urlErr *url.Error
+	var resErr *responseError
+	return errors.As(err, &urlErr) || errors.As(err, &resErr) || IsCircuitOpen(err)
+}
+
+// isStaleMetadata reports whether err hints that cached metadata is outdated,
+// e.g. a partition which does not exist or whose leader is not available.
+func isStaleMetadata(err error, pr *ProducerResponse) bool {
+	if pr != nil {
+		for _, offset := range pr.Offsets {
+			if offset.ErrorCode == ProducerErrCodeRetriable {
+				return true
+			}
+		}
+	}
+
+	apiErr, ok := errors.Cause(err).(*APIError)
+	if !ok {
+		return false
+	}
+
+	switch apiErr.ErrorCode {
+	case ErrCodeTopicNotFound, ErrCodePartitionNotFound, ErrCodeRetriableKafka:
+		return true
+	}
+	return false
+}
+
 func getConsumerGroup(cs *Consumers, consumerGroup []string) (string, error) {
 	switch {
-	case len(consumerGroup) > 0:
+	case len(consumerGroup) > 0 && consumerGroup[0] != "":
 		return consumerGroup[0], nil
 	case cs.ConsumerGroup != "":
 		return cs.ConsumerGroup, nil
@@ -245,12 +460,13 @@ func getTopicName(t *Topic, topicName []string) (string, error) {
 	}
 }
 
-func doRequest(method, url string, client *http.Client, b *bytes.Buffer, requestHooker func(*http.Request), responseHooker func(*http.Response) error) error {
-	req, err := http.NewRequest(method, url, b)
+func doRequest(ctx context.Context, method, url string, client *http.Client, body io.Reader, requestHooker func(*http.Request), responseHooker func(*http.Response) error) error {
+	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return err
 	}
 
+	req = req.WithContext(ctx)
 	requestHooker(req)
 
 	res, err := client.Do(req)
@@ -267,20 +483,65 @@ func doRequest(method, url string, client *http.Client, b *bytes.Buffer, request
 	return nil
 }
 
-// URLJoin joins url with path and return the whole url string.
+// URLJoin joins url with path segments and return the whole url string.
+// Each segment is percent-escaped as a whole, so that names containing "/", "?", "#" or "%" stay one segment.
+// Empty, "." and ".." segments are rejected.
 func URLJoin(urlstr string, pathstrs ...string) (string, error) {
 	u, err := url.Parse(urlstr)
 	if err != nil {
 		return "", err
 	}
-	str := strings.Join(pathstrs, "/")
-	u.Path = path.Join(u.Path, str)
+	if u.Opaque != "" {
+		return "", errors.Errorf("Error: invalid URL %q", urlstr)
+	}
+
+	escaped := strings.TrimSuffix(u.EscapedPath(), "/")
+	for _, segment := range pathstrs {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", errors.Errorf("Error: invalid path segment %q", segment)
+		}
+		escaped += "/" + url.PathEscape(segment)
+	}
+
+	u.Path, err = url.PathUnescape(escaped)
+	if err != nil {
+		return "", err
+	}
+	u.RawPath = escaped
 	return u.String(), nil
 }
 
+// ValidateTopicName returns an error if name is not a legal Kafka topic name,
+// at most 249 ASCII letters, digits, ".", "_" and "-", other than "." and "..".
+func ValidateTopicName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("Error: empty topicName")
+	case name == "." || name == "..":
+		return errors.Errorf("Error: illegal topic name %q", name)
+	case len(name) > maxTopicNameLength:
+		return errors.Errorf("Error: topic name %q longer than %d characters", name, maxTopicNameLength)
+	}
+
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			return errors.Errorf("Error: illegal character %q in topic name %q", c, name)
+		}
+	}
+	return nil
+}
+
+// topicURL validates topicName and joins url with the topic path and path segments.
+func topicURL(urlstr, topicName string, pathstrs ...string) (string, error) {
+	if err := ValidateTopicName(topicName); err != nil {
+		return "", err
+	}
+	return URLJoin(urlstr, append([]string{"topics", topicName}, pathstrs...)...)
+}
+
 // New returns a Kafka instance with default setting.
 func New(options ...func(*Kafka) error) (*Kafka, error) {
-	var k Kafka
+	k := Kafka{mu: new(sync.Mutex)}
 	applyDefaults(&k)
 	err := k.SetOption(options...)
 	if err != nil {
@@ -289,6 +550,19 @@ func New(options ...func(*Kafka) error) (*Kafka, error) {
 	return &k, nil
 }
 
+// sharedMu guards the state created on first use of Kafka not created by New.
+var sharedMu sync.Mutex
+
+// lock locks the mutex guarding the state of Kafka created on first use, the returned func unlocks it.
+func (k *Kafka) lock() func() {
+	mu := k.mu
+	if mu == nil {
+		mu = &sharedMu
+	}
+	mu.Lock()
+	return mu.Unlock
+}
+
 // NewTopics returns a Topics instance.
 func (k *Kafka) NewTopics() *Topics {
 	return &Topics{
@@ -312,13 +586,19 @@ func (k *Kafka) NewConsumers(consumerGroup ...string) *Consumers {
 
 // Broker returns the brokers.
 func (k *Kafka) Broker() (*Broker, error) {
+	return k.BrokerContext(context.Background())
+}
+
+// BrokerContext is like Broker but with a context.
+func (k *Kafka) BrokerContext(ctx context.Context) (*Broker, error) {
 	client := k.HTTPClient()
 	url, err := URLJoin(k.URL, "brokers")
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /brokers", Partition: -1})
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -337,8 +617,8 @@ func (k *Kafka) Broker() (*Broker, error) {
 
 	b := &Broker{}
 
-	err = json.NewDecoder(res.Body).Decode(b)
-	if err != nil && err != io.EOF {
+	err = k.decode(res, b)
+	if err != nil {
 		return nil, err
 	}
 
@@ -346,7 +626,95 @@ func (k *Kafka) Broker() (*Broker, error) {
 }
 
 func closeBody(res *http.Response) {
-	// Drain and close the body to let the Transport reuse the connection
-	io.Copy(ioutil.Discard, res.Body)
+	// Drain and close the body to let the Transport reuse the connection, unless it is too long to be worth it
+	io.CopyN(ioutil.Discard, res.Body, maxErrorBody)
 	res.Body.Close()
 }
+
+// maxFanOut bounds the number of concurrent requests a single call fans out to.
+const maxFanOut = 8
+
+// fanOut calls fn for 0 to n-1 concurrently, at most maxFanOut at a time.
+// It returns the first error, ctx passed to the other calls is cancelled then.
+func fanOut(ctx context.Context, n int, fn func(context.Context, int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	sem := make(chan struct{}, maxFanOut)
+
+	for i := 0; i < n; i++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i); err != nil {
+				once.Do(func() { firstErr = err })
+				cancel()
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	if firstErr == nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// backoff computes exponentially growing waits with jitter between retries.
+type backoff struct {
+	min, max time.Duration
+	attempt  uint
+}
+
+func newBackoff() *backoff {
+	return &backoff{min: minBackoff, max: maxBackoff}
+}
+
+// next returns the wait before the next retry.
+func (b *backoff) next() time.Duration {
+	d := b.max
+	if b.attempt < 32 && b.min<<b.attempt < b.max {
+		d = b.min << b.attempt
+	}
+	b.attempt++
+	// equal jitter, wait at least half of d
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
+
+// sleepContext waits for d, it returns false if ctx is done before.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
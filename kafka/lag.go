@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type (
+	// PartitionLag is the lag of a consumer group on a partition
+	PartitionLag struct {
+		Topic     string `json:"topic"`
+		Partition int    `json:"partition"`
+		// CommittedOffset is -1 if the group has not committed any offset for the partition
+		CommittedOffset int64 `json:"committed_offset"`
+		BeginningOffset int64 `json:"beginning_offset"`
+		EndOffset       int64 `json:"end_offset"`
+		Lag             int64 `json:"lag"`
+	}
+
+	// ConsumerLag is the lag of a consumer group per partition and in total
+	ConsumerLag struct {
+		Partitions []PartitionLag `json:"partitions"`
+		Total      int64          `json:"total"`
+	}
+)
+
+const defaultLagInterval = 10 * time.Second
+
+// Lag computes the lag of the consumer group via API v2, from the committed offsets and the end offsets
+// of the partitions manually assigned to the consumer instance, or of all the partitions of its subscribed topics.
+// The lag of a partition without committed offset counts from its beginning offset.
+func (cs *Consumers) Lag(ctx context.Context, consumerName string, consumerGroup ...string) (*ConsumerLag, error) {
+	cg, err := getConsumerGroup(cs, consumerGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions, err := cs.lagPartitions(ctx, consumerName, cg)
+	if err != nil {
+		return nil, err
+	}
+
+	cl := &ConsumerLag{Partitions: make([]PartitionLag, len(partitions))}
+	if len(partitions) == 0 {
+		return cl, nil
+	}
+
+	committed, err := cs.OffsetsContext(ctx, &ConsumerOffsetsPartitions{Partitions: partitions}, consumerName, cg)
+	if err != nil {
+		return nil, err
+	}
+
+	committedOffsets := make(map[ConsumerPartitions]int64, len(committed.Offsets))
+	for _, co := range committed.Offsets {
+		committedOffsets[ConsumerPartitions{Topic: co.Topic, Partition: co.Partition}] = co.Offset
+	}
+
+	ps := cs.Kafka.NewTopics().NewPartitions()
+	err = fanOut(ctx, len(partitions), func(ctx context.Context, i int) error {
+		tp := partitions[i]
+		po, err := ps.Offsets(ctx, tp.Partition, tp.Topic)
+		if err != nil {
+			return err
+		}
+
+		pl := PartitionLag{
+			Topic:           tp.Topic,
+			Partition:       tp.Partition,
+			CommittedOffset: -1,
+			BeginningOffset: po.BeginningOffset,
+			EndOffset:       po.EndOffset,
+		}
+
+		from := po.BeginningOffset
+		if offset, ok := committedOffsets[tp]; ok && offset >= 0 {
+			pl.CommittedOffset = offset
+			from = offset
+		}
+		if pl.EndOffset > from {
+			pl.Lag = pl.EndOffset - from
+		}
+
+		cl.Partitions[i] = pl
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(cl.Partitions, func(i, j int) bool {
+		a, b := cl.Partitions[i], cl.Partitions[j]
+		return a.Topic < b.Topic || (a.Topic == b.Topic && a.Partition < b.Partition)
+	})
+	for _, pl := range cl.Partitions {
+		cl.Total += pl.Lag
+	}
+	cs.Kafka.metrics().Lag(cg, cl)
+
+	return cl, nil
+}
+
+// SampleLag keeps computing the lag of the consumer group every interval, default to 10s if not positive,
+// until ctx is done or the returned func is called. onLag handles each sample or the error computing it.
+// The returned func cancels sampling and waits for it to stop, it must not be called from onLag.
+func (cs *Consumers) SampleLag(ctx context.Context, interval time.Duration, consumerName string, onLag func(*ConsumerLag, error), consumerGroup ...string) func() {
+	if interval <= 0 {
+		interval = defaultLagInterval
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	cancelFunc := func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		for {
+			cl, err := cs.Lag(ctx, consumerName, consumerGroup...)
+			if ctx.Err() != nil {
+				return
+			}
+			onLag(cl, err)
+
+			if !sleepContext(ctx, interval) {
+				return
+			}
+		}
+	}()
+
+	return cancelFunc
+}
+
+// lagPartitions returns the partitions assigned to the consumer instance, or else of its subscribed topics.
+func (cs *Consumers) lagPartitions(ctx context.Context, consumerName, consumerGroup string) ([]ConsumerPartitions, error) {
+	assigned, err := cs.AssignmentsContext(ctx, consumerName, consumerGroup)
+	if err != nil {
+		return nil, err
+	}
+	if len(assigned.Partitions) > 0 {
+		return assigned.Partitions, nil
+	}
+
+	subscribed, err := cs.SubscriptionsContext(ctx, consumerName, consumerGroup)
+	if err != nil {
+		return nil, err
+	}
+
+	ps := cs.Kafka.NewTopics().NewPartitions()
+	var partitions []ConsumerPartitions
+	for _, topic := range subscribed.Topics {
+		pss, err := ps.PartitionsContext(ctx, topic)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range pss {
+			partitions = append(partitions, ConsumerPartitions{Topic: topic, Partition: p.Partition})
+		}
+	}
+
+	return partitions, nil
+}
@@ -0,0 +1,321 @@
+package kafka
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// EndpointClass groups endpoints sharing client-side limits.
+	EndpointClass string
+
+	// Limit is a client-side limit of requests to the REST proxy.
+	Limit struct {
+		// Rate is the number of requests per second allowed by a token bucket, unlimited if 0
+		Rate float64
+		// Burst is the size of the token bucket, default to 1
+		Burst int
+		// MaxConcurrent is the maximum number of requests in flight, until their response body is closed, unlimited if 0
+		MaxConcurrent int
+	}
+
+	// limiters are the limiters of Kafka, created from Limits on first use.
+	limiters struct {
+		classes map[EndpointClass]*limiter
+
+		mu sync.Mutex
+		// throttled is until when requests of each class are paused after a 429 response
+		throttled map[EndpointClass]time.Time
+	}
+
+	limiter struct {
+		sem chan struct{}
+
+		mu     sync.Mutex
+		rate   float64
+		burst  float64
+		tokens float64
+		last   time.Time
+	}
+
+	limitTransport struct {
+		kafka *Kafka
+		base  http.RoundTripper
+	}
+
+	// releaseBody releases the limits held by a request once its response body is closed.
+	releaseBody struct {
+		io.ReadCloser
+		release func()
+	}
+)
+
+const (
+	// AllEndpoints is the class of all endpoints, its Limit applies to every request in addition to the one of its class
+	AllEndpoints = EndpointClass("")
+	// MetadataEndpoints are the class of brokers, topics and partitions metadata endpoints
+	MetadataEndpoints = EndpointClass("metadata")
+	// ProduceEndpoints are the class of produce endpoints
+	ProduceEndpoints = EndpointClass("produce")
+	// ConsumeEndpoints are the class of consumer instance endpoints and of partition messages
+	ConsumeEndpoints = EndpointClass("consume")
+
+	// defaultRetryAfter is the wait after a 429 response without valid Retry-After header
+	defaultRetryAfter = time.Second
+	// maxRetryAfter caps the wait after a 429 response
+	maxRetryAfter = time.Minute
+)
+
+// Class returns the EndpointClass of the endpoint.
+func (e Endpoint) Class() EndpointClass {
+	switch {
+	case strings.HasPrefix(e.Name, "POST /topics/"):
+		return ProduceEndpoints
+	case strings.Contains(e.Name, " /consumers/"), strings.HasSuffix(e.Name, "/messages"):
+		return ConsumeEndpoints
+	default:
+		return MetadataEndpoints
+	}
+}
+
+// SetLimit applies limit to the classes of Limits of Kafka, to AllEndpoints if none is provided.
+func SetLimit(limit Limit, classes ...EndpointClass) func(*Kafka) error {
+	return func(k *Kafka) error {
+		if limit.Rate < 0 || limit.Burst < 0 || limit.MaxConcurrent < 0 {
+			return errors.New("Error: negative Limit")
+		}
+		if len(classes) == 0 {
+			classes = []EndpointClass{AllEndpoints}
+		}
+
+		limits := make(map[EndpointClass]Limit, len(k.Limits)+len(classes))
+		for c, l := range k.Limits {
+			limits[c] = l
+		}
+		for _, c := range classes {
+			limits[c] = limit
+		}
+		k.Limits = limits
+		return nil
+	}
+}
+
+// SetMaxThrottleRetries applies MaxThrottleRetries to Kafka.
+func SetMaxThrottleRetries(maxThrottleRetries int) func(*Kafka) error {
+	return func(k *Kafka) error {
+		k.MaxThrottleRetries = maxThrottleRetries
+		return nil
+	}
+}
+
+// limiters returns the limiters of Kafka, created from Limits on first use.
+func (k *Kafka) limiters() *limiters {
+	defer k.lock()()
+
+	if k.limits == nil {
+		k.limits = &limiters{
+			classes:   make(map[EndpointClass]*limiter, len(k.Limits)),
+			throttled: make(map[EndpointClass]time.Time),
+		}
+		for c, l := range k.Limits {
+			k.limits.classes[c] = newLimiter(l)
+		}
+	}
+	return k.limits
+}
+
+func newLimiter(l Limit) *limiter {
+	lim := &limiter{rate: l.Rate, burst: math.Max(float64(l.Burst), 1)}
+	lim.tokens = lim.burst
+	if l.MaxConcurrent > 0 {
+		lim.sem = make(chan struct{}, l.MaxConcurrent)
+	}
+	return lim
+}
+
+// acquire waits for a token and a concurrency slot, the returned func releases the slot.
+func (lim *limiter) acquire(ctx context.Context) (func(), error) {
+	if wait := lim.reserve(time.Now()); wait > 0 && !sleepContext(ctx, wait) {
+		lim.cancel()
+		return nil, ctx.Err()
+	}
+
+	if lim.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case lim.sem <- struct{}{}:
+		return func() { <-lim.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// reserve takes a token from the bucket, returning how long to wait until it is available.
+func (lim *limiter) reserve(now time.Time) time.Duration {
+	if lim.rate <= 0 {
+		return 0
+	}
+
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+
+	if !lim.last.IsZero() {
+		lim.tokens = math.Min(lim.burst, lim.tokens+now.Sub(lim.last).Seconds()*lim.rate)
+	}
+	lim.last = now
+	lim.tokens--
+	if lim.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-lim.tokens / lim.rate * float64(time.Second))
+}
+
+// cancel gives back the token of a reservation which is not used.
+func (lim *limiter) cancel() {
+	if lim.rate <= 0 {
+		return
+	}
+
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	lim.tokens = math.Min(lim.burst, lim.tokens+1)
+}
+
+// throttle pauses the requests of the class until after wait.
+func (ls *limiters) throttle(class EndpointClass, wait time.Duration) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if until := time.Now().Add(wait); until.After(ls.throttled[class]) {
+		ls.throttled[class] = until
+	}
+}
+
+// throttledFor returns how long the requests of the class are paused.
+func (ls *limiters) throttledFor(class EndpointClass) time.Duration {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return time.Until(ls.throttled[class])
+}
+
+// acquire waits until the request of the class may be made, the returned func must be called once it is done.
+func (ls *limiters) acquire(ctx context.Context, class EndpointClass) (func(), error) {
+	if !sleepContext(ctx, ls.throttledFor(class)) {
+		return nil, ctx.Err()
+	}
+
+	var releases []func()
+	release := func() {
+		for _, r := range releases {
+			r()
+		}
+	}
+
+	for _, c := range []EndpointClass{AllEndpoints, class} {
+		lim, ok := ls.classes[c]
+		if !ok {
+			continue
+		}
+		r, err := lim.acquire(ctx)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+
+	return release, nil
+}
+
+// RoundTrip implements http.RoundTripper. Requests wait for the Limits of their class and are in flight until
+// their response body is closed. Requests throttled with status 429 pause their class for Retry-After,
+// then they are retried up to MaxThrottleRetries times.
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	e, ok := EndpointFrom(ctx)
+	if !ok {
+		e = Endpoint{Name: req.Method, Partition: -1}
+	}
+	class := e.Class()
+	ls := t.kafka.limiters()
+
+	for attempt := 0; ; attempt++ {
+		release, err := ls.acquire(ctx, class)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := t.base.RoundTrip(req)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		// the request is in flight until its body is closed
+		res.Body = &releaseBody{ReadCloser: res.Body, release: sync.OnceFunc(release)}
+		if res.StatusCode != http.StatusTooManyRequests {
+			return res, nil
+		}
+
+		wait := retryAfter(res.Header.Get("Retry-After"), time.Now())
+		ls.throttle(class, wait)
+
+		if attempt >= t.kafka.MaxThrottleRetries || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+			return res, nil
+		}
+
+		body, err := rewind(req)
+		if err != nil {
+			return res, nil
+		}
+		closeBody(res)
+
+		t.kafka.retry(ctx, "throttled", errors.Errorf("Error: %v throttled", e.Name),
+			slog.String("endpoint", e.Name), slog.Duration("retry_after", wait))
+		req = req.Clone(ctx)
+		req.Body = body
+	}
+}
+
+// Close implements io.Closer, releasing the limits held by the request.
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// rewind returns a new copy of the body of req to send it again.
+func rewind(req *http.Request) (io.ReadCloser, error) {
+	if req.GetBody == nil {
+		return req.Body, nil
+	}
+	return req.GetBody()
+}
+
+// retryAfter parses the Retry-After header, in seconds or as an HTTP date,
+// defaultRetryAfter if it is missing or invalid, capped to maxRetryAfter.
+func retryAfter(header string, now time.Time) time.Duration {
+	wait := defaultRetryAfter
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil && seconds >= 0 {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(header); err == nil {
+		wait = date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+	}
+
+	if wait > maxRetryAfter {
+		wait = maxRetryAfter
+	}
+	return wait
+}
@@ -0,0 +1,157 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type (
+	loggingTransport struct {
+		logger *slog.Logger
+		base   http.RoundTripper
+	}
+
+	// discardHandler is a slog.Handler discarding all records, for a Kafka without Logger.
+	discardHandler struct{}
+)
+
+// SetLogger applies Logger to Kafka.
+func SetLogger(logger *slog.Logger) func(*Kafka) error {
+	return func(k *Kafka) error {
+		k.Logger = logger
+		return nil
+	}
+}
+
+// SetLogPayloads applies LogPayloads to Kafka.
+func SetLogPayloads(logPayloads bool) func(*Kafka) error {
+	return func(k *Kafka) error {
+		k.LogPayloads = logPayloads
+		return nil
+	}
+}
+
+// logger returns Logger, discarding records if nil.
+func (k *Kafka) logger() *slog.Logger {
+	if k.Logger == nil {
+		return slog.New(discardHandler{})
+	}
+	return k.Logger
+}
+
+// RoundTrip implements http.RoundTripper, logging the start and finish of requests at debug level,
+// failed requests at warn level. URLs are logged without password, headers and bodies are not logged.
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	attrs := []slog.Attr{slog.String("method", req.Method), slog.String("url", req.URL.Redacted())}
+	if e, ok := EndpointFrom(ctx); ok {
+		attrs = append(attrs, endpointAttrs(e)...)
+	}
+	t.logger.LogAttrs(ctx, slog.LevelDebug, "kafka: request started", attrs...)
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		t.logger.LogAttrs(ctx, slog.LevelWarn, "kafka: request failed", append(attrs, slog.Any("error", err))...)
+		return nil, err
+	}
+
+	level := slog.LevelDebug
+	if res.StatusCode >= http.StatusBadRequest {
+		level = slog.LevelWarn
+	}
+	t.logger.LogAttrs(ctx, level, "kafka: request finished", append(attrs, slog.Int("status", res.StatusCode))...)
+	return res, nil
+}
+
+// logProduced logs the outcome of a produce, with the records if LogPayloads is set.
+func (k *Kafka) logProduced(ctx context.Context, topicName string, message *ProducerMessage, err error) {
+	logger := k.logger()
+	attrs := []slog.Attr{slog.String("topic", topicName)}
+	if message != nil {
+		attrs = append(attrs, slog.Int("records", len(message.Records)))
+		if k.LogPayloads {
+			attrs = append(attrs, slog.Any("payload", message.Records))
+		}
+	}
+
+	if err != nil {
+		logger.LogAttrs(ctx, slog.LevelWarn, "kafka: produce failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "kafka: produced", attrs...)
+}
+
+// logFetched logs the messages fetched by the consumer group, with their keys and values if LogPayloads is set.
+func (k *Kafka) logFetched(ctx context.Context, group string, messages []Message, err error) {
+	if err != nil {
+		// logged by Poll, ManagedConsumer or the caller, which know whether it is retried
+		return
+	}
+
+	attrs := []slog.Attr{slog.String("group", group), slog.Int("messages", len(messages))}
+	if k.LogPayloads {
+		attrs = append(attrs, slog.Any("payload", messages))
+	}
+	k.logger().LogAttrs(ctx, slog.LevelDebug, "kafka: fetched", attrs...)
+}
+
+// invalidateStale invalidates the cached metadata of the topic after an error hinting it is outdated,
+// e.g. after a partition leader failover.
+func (k *Kafka) invalidateStale(ctx context.Context, topicName string) {
+	k.logger().LogAttrs(ctx, slog.LevelInfo, "kafka: stale metadata invalidated", slog.String("topic", topicName))
+	k.Metadata().Invalidate(topicName)
+}
+
+// retry reports to Metrics and logs at warn level that operation failed with err and is retried.
+func (k *Kafka) retry(ctx context.Context, operation string, err error, attrs ...slog.Attr) {
+	k.metrics().Retry(operation)
+	attrs = append([]slog.Attr{slog.String("operation", operation), slog.Any("error", err)}, attrs...)
+	k.logger().LogAttrs(ctx, slog.LevelWarn, "kafka: retrying", attrs...)
+}
+
+// logCommitted logs the offsets committed for the consumer instance at debug level, at warn level if it failed.
+func (k *Kafka) logCommitted(ctx context.Context, group, consumerName string, consumerOffsets *ConsumerOffsets, err error) {
+	attrs := []slog.Attr{slog.String("group", group), slog.String("instance", consumerName)}
+	if consumerOffsets != nil {
+		attrs = append(attrs, slog.Any("offsets", consumerOffsets.Offsets))
+	}
+
+	if err != nil {
+		k.logger().LogAttrs(ctx, slog.LevelWarn, "kafka: commit failed", append(attrs, slog.Any("error", err))...)
+		return
+	}
+	k.logger().LogAttrs(ctx, slog.LevelDebug, "kafka: committed", attrs...)
+}
+
+func endpointAttrs(e Endpoint) []slog.Attr {
+	attrs := []slog.Attr{slog.String("endpoint", e.Name)}
+	if e.Topic != "" {
+		attrs = append(attrs, slog.String("topic", e.Topic))
+	}
+	if e.Partition >= 0 {
+		attrs = append(attrs, slog.Int("partition", e.Partition))
+	}
+	if e.Group != "" {
+		attrs = append(attrs, slog.String("group", e.Group))
+	}
+	if e.Instance != "" {
+		attrs = append(attrs, slog.String("instance", e.Instance))
+	}
+	return attrs
+}
+
+// Enabled implements slog.Handler.
+func (discardHandler) Enabled(context.Context, slog.Level) bool { return false }
+
+// Handle implements slog.Handler.
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+
+// WithAttrs implements slog.Handler.
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+// WithGroup implements slog.Handler.
+func (h discardHandler) WithGroup(string) slog.Handler { return h }
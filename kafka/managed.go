@@ -0,0 +1,335 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// ManagedConsumer owns a consumer instance for its whole lifecycle.
+	// Run creates the instance, subscribes to Topics or TopicPattern or assigns Partitions,
+	// fetches continuously and commits after each batch is handled successfully.
+	// The instance is recreated transparently if the REST proxy expires it, transient errors are retried
+	// with exponential backoff, and the instance is unsubscribed and deleted when Run returns.
+	// A ManagedConsumer is not safe for concurrent use by multiple goroutines.
+	ManagedConsumer struct {
+		Consumers       *Consumers
+		ConsumerGroup   string
+		ConsumerRequest ConsumerRequest
+		// Topics to subscribe to, API v1 fetches from each topic in turn.
+		Topics []string
+		// TopicPattern to subscribe to via API v2, mutually exclusive with Topics.
+		TopicPattern string
+		// Partitions to assign manually via API v2, takes precedence over Topics and TopicPattern.
+		Partitions []ConsumerPartitions
+		// Timeout is the number of milliseconds for the underlying request to fetch the records via API v2.
+		Timeout int
+		// MaxBytes is the maximum number of bytes of unencoded keys and values in a fetch response.
+		MaxBytes int
+		// IdleInterval is the wait before fetching again after an empty fetch. Default to 1s.
+		IdleInterval time.Duration
+		// MaxMessages stops Run after as many messages are handled, unlimited if 0. The last batch is cut short
+		// so that only the handled messages are committed, via API v1 it is not committed as the instance
+		// commits all the messages it fetched.
+		MaxMessages int
+
+		instance *ConsumerInstance
+		next     int
+		handled  int
+	}
+)
+
+const defaultIdleInterval = time.Second
+
+// NewManagedConsumer returns a ManagedConsumer instance.
+func (cs *Consumers) NewManagedConsumer(consumerRequest ConsumerRequest, consumerGroup ...string) *ManagedConsumer {
+	mc := ManagedConsumer{
+		Consumers:       cs,
+		ConsumerGroup:   cs.ConsumerGroup,
+		ConsumerRequest: consumerRequest,
+	}
+
+	if len(consumerGroup) > 0 {
+		mc.ConsumerGroup = consumerGroup[0]
+	}
+
+	return &mc
+}
+
+// Run consumes messages until ctx is done, handler returns an error or a request fails with a non-retriable error,
+// e.g. a 4xx response other than 429. Requests without response, with 429 or 5xx responses or truncated ones are retried.
+// Offsets of a batch are committed only after handler returns nil for it,
+// unless ConsumerRequest.AutoCommit is "true".
+// Run returns ctx.Err() on cancellation, nil once MaxMessages are handled, the consumer instance is cleaned up in any case.
+func (mc *ManagedConsumer) Run(ctx context.Context, handler func(context.Context, []Message) error) (err error) {
+	if mc.ConsumerGroup == "" {
+		return errors.New("Error: empty consumerGroup")
+	}
+	if len(mc.Topics) == 0 && mc.TopicPattern == "" && len(mc.Partitions) == 0 {
+		return errors.New("Error: empty Topics TopicPattern and Partitions")
+	}
+	if mc.Consumers.Kafka.Version == V1 && len(mc.Topics) == 0 {
+		return errors.New("Error: empty Topics for API v1")
+	}
+
+	mc.handled = 0
+	defer func() {
+		if cerr := mc.close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	interval := mc.IdleInterval
+	if interval <= 0 {
+		interval = defaultIdleInterval
+	}
+	metrics := mc.Consumers.Kafka.metrics()
+
+	defer func() {
+		if err != nil && err != ctx.Err() {
+			mc.Consumers.Kafka.logger().LogAttrs(ctx, slog.LevelError, "kafka: managed consumer stopped",
+				slog.String("group", mc.ConsumerGroup), slog.Any("error", err))
+		}
+	}()
+
+	bo := newBackoff()
+	for {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if mc.instance == nil {
+			err = mc.open(ctx)
+			switch {
+			case err != nil && ctx.Err() != nil:
+				return ctx.Err()
+			case isRetriable(err), IsConsumerInstanceNotFound(err):
+				if !mc.backoff(ctx, bo, "consumer_instance", err) {
+					return ctx.Err()
+				}
+				continue
+			case err != nil:
+				return err
+			}
+		}
+
+		var messages []Message
+		messages, err = mc.fetch(ctx)
+		switch {
+		case err != nil && ctx.Err() != nil:
+			return ctx.Err()
+		case IsConsumerInstanceNotFound(err):
+			if !mc.expired(ctx, bo, err) {
+				return ctx.Err()
+			}
+			continue
+		case isRetriable(err):
+			if !mc.backoff(ctx, bo, "fetch", err) {
+				return ctx.Err()
+			}
+			continue
+		case err != nil:
+			return err
+		}
+		bo.reset()
+
+		if len(messages) == 0 {
+			if !sleepContext(ctx, interval) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		partial := mc.MaxMessages > 0 && mc.handled+len(messages) > mc.MaxMessages
+		if partial {
+			messages = messages[:mc.MaxMessages-mc.handled]
+		}
+
+		metrics.InFlight(mc.ConsumerGroup, len(messages))
+		err = handler(ctx, messages)
+		metrics.InFlight(mc.ConsumerGroup, 0)
+		if err != nil {
+			return err
+		}
+		mc.handled += len(messages)
+
+		if !partial || mc.Consumers.Kafka.Version != V1 {
+			if err = mc.commitRetry(ctx, bo, messages); err != nil {
+				return err
+			}
+		}
+		if mc.MaxMessages > 0 && mc.handled >= mc.MaxMessages {
+			return nil
+		}
+	}
+}
+
+// commitRetry commits the offsets of the handled messages, retrying transient errors with backoff.
+// Messages are fetched again from the committed offsets if the consumer instance expired meanwhile.
+func (mc *ManagedConsumer) commitRetry(ctx context.Context, bo *backoff, messages []Message) error {
+	for {
+		// commit even if ctx is done while handling, the batch has been processed
+		err := mc.commit(context.WithoutCancel(ctx), messages)
+		switch {
+		case err == nil:
+			bo.reset()
+			return nil
+		case IsConsumerInstanceNotFound(err):
+			if !mc.expired(ctx, bo, err) {
+				return ctx.Err()
+			}
+			return nil
+		case isRetriable(err):
+			if !mc.backoff(ctx, bo, "commit", err) {
+				return ctx.Err()
+			}
+		default:
+			return err
+		}
+	}
+}
+
+// expired forgets the consumer instance expired by the REST proxy, it is recreated after backoff.
+func (mc *ManagedConsumer) expired(ctx context.Context, bo *backoff, err error) bool {
+	mc.Consumers.Kafka.logger().LogAttrs(ctx, slog.LevelWarn, "kafka: consumer instance expired",
+		slog.String("group", mc.ConsumerGroup), slog.String("instance", mc.instance.ConsumerName))
+	mc.instance = nil
+	return mc.backoff(ctx, bo, "consumer_instance", err)
+}
+
+// backoff reports that operation failed with err and is retried, then waits for the next backoff.
+// It returns false if ctx is done before.
+func (mc *ManagedConsumer) backoff(ctx context.Context, bo *backoff, operation string, err error) bool {
+	wait := bo.next()
+	mc.Consumers.Kafka.retry(ctx, operation, err, slog.String("group", mc.ConsumerGroup), slog.Duration("backoff", wait))
+	return sleepContext(ctx, wait)
+}
+
+func (mc *ManagedConsumer) open(ctx context.Context) error {
+	cs := mc.Consumers
+	cr := mc.ConsumerRequest
+	if cr.AutoCommit == "" {
+		cr.AutoCommit = "false"
+	}
+
+	ci, err := cs.NewConsumerContext(ctx, &cr, mc.ConsumerGroup)
+	if err != nil {
+		return err
+	}
+	mc.instance = ci
+
+	if cs.Kafka.Version == V1 {
+		return nil
+	}
+
+	switch {
+	case len(mc.Partitions) > 0:
+		err = cs.AssignContext(ctx, &ConsumerOffsetsPartitions{Partitions: mc.Partitions}, ci.ConsumerName, mc.ConsumerGroup)
+	case mc.TopicPattern != "":
+		ts := &TopicSubscription{TopicPattern: &TopicPatternSubscription{TopicPattern: mc.TopicPattern}}
+		err = cs.SubscribeContext(ctx, ts, true, ci.ConsumerName, mc.ConsumerGroup)
+	default:
+		ts := &TopicSubscription{Topics: &TopicsSubscription{Topics: mc.Topics}}
+		err = cs.SubscribeContext(ctx, ts, false, ci.ConsumerName, mc.ConsumerGroup)
+	}
+
+	if err != nil {
+		mc.close()
+		return err
+	}
+
+	return nil
+}
+
+func (mc *ManagedConsumer) fetch(ctx context.Context) ([]Message, error) {
+	arg := Argument{
+		Timeout:       mc.Timeout,
+		MaxBytes:      mc.MaxBytes,
+		ConsumerName:  mc.instance.ConsumerName,
+		ConsumerGroup: mc.ConsumerGroup,
+	}
+
+	if mc.Consumers.Kafka.Version == V1 {
+		arg.TopicName = mc.Topics[mc.next%len(mc.Topics)]
+		mc.next++
+	}
+
+	return mc.Consumers.fetch(ctx, arg)
+}
+
+func (mc *ManagedConsumer) commit(ctx context.Context, messages []Message) error {
+	if mc.ConsumerRequest.AutoCommit == "true" {
+		return nil
+	}
+
+	// API v1 commits all the offsets consumed so far by the instance
+	consumerOffsets := &ConsumerOffsets{}
+	if mc.Consumers.Kafka.Version != V1 {
+		consumerOffsets = NextOffsets(messages)
+	}
+
+	return mc.Consumers.CommitOffsetsContext(ctx, consumerOffsets, mc.instance.ConsumerName, mc.ConsumerGroup)
+}
+
+// close unsubscribes and deletes the consumer instance, if any.
+func (mc *ManagedConsumer) close() error {
+	if mc.instance == nil {
+		return nil
+	}
+
+	cs := mc.Consumers
+	name := mc.instance.ConsumerName
+	mc.instance = nil
+
+	// ctx passed to Run is likely done already, a zero Timeout means none as for the HTTP client
+	ctx := context.Background()
+	if cs.Kafka.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cs.Kafka.Timeout)
+		defer cancel()
+	}
+
+	if cs.Kafka.Version != V1 && len(mc.Partitions) == 0 {
+		err := cs.UnsubscribeContext(ctx, name, mc.ConsumerGroup)
+		if err != nil && !IsConsumerInstanceNotFound(err) {
+			cs.DeleteConsumerContext(ctx, name, mc.ConsumerGroup)
+			return err
+		}
+	}
+
+	err := cs.DeleteConsumerContext(ctx, name, mc.ConsumerGroup)
+	if err != nil && !IsConsumerInstanceNotFound(err) {
+		return err
+	}
+
+	return nil
+}
+
+// NextOffsets returns the offsets to commit after messages are consumed,
+// which is the highest offset plus one for each topic partition.
+func NextOffsets(messages []Message) *ConsumerOffsets {
+	consumerOffsets := &ConsumerOffsets{}
+	index := make(map[ConsumerPartitions]int)
+
+	for _, m := range messages {
+		tp := ConsumerPartitions{Topic: m.Topic, Partition: m.Partition}
+		i, ok := index[tp]
+		if !ok {
+			index[tp] = len(consumerOffsets.Offsets)
+			consumerOffsets.Offsets = append(consumerOffsets.Offsets, ConsumerOffset{
+				Topic:     m.Topic,
+				Partition: m.Partition,
+				Offset:    m.Offset + 1,
+			})
+			continue
+		}
+		if m.Offset+1 > consumerOffsets.Offsets[i].Offset {
+			consumerOffsets.Offsets[i].Offset = m.Offset + 1
+		}
+	}
+
+	return consumerOffsets
+}
@@ -0,0 +1,266 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// Metadata caches the cluster metadata of Kafka, topic names and topics with their partitions,
+	// leaders and configs, for Kafka.MetadataTTL. Stale entries are served while they are refreshed in the background,
+	// missing or invalidated entries are fetched before returning, AutoRefresh keeps cached entries fresh periodically.
+	// Concurrent fetches of an entry are single-flight. Values returned are copies of the cached ones.
+	// Partitions.Produce checks partitions against the partition counts it caches.
+	// A Metadata is safe for concurrent use by multiple goroutines.
+	Metadata struct {
+		Kafka *Kafka
+
+		mu      sync.Mutex
+		entries map[string]*metadataEntry
+		flights map[string]*metadataFlight
+	}
+
+	metadataEntry struct {
+		value   interface{}
+		fetch   func(context.Context) (interface{}, error)
+		fetched time.Time
+		invalid bool
+	}
+
+	metadataFlight struct {
+		done  chan struct{}
+		value interface{}
+		err   error
+	}
+)
+
+const (
+	namesKey       = "names"
+	topicKeyPrefix = "topic/"
+)
+
+// Metadata returns the metadata cache of Kafka.
+func (k *Kafka) Metadata() *Metadata {
+	defer k.lock()()
+
+	if k.metadata == nil {
+		k.metadata = &Metadata{
+			Kafka:   k,
+			entries: make(map[string]*metadataEntry),
+			flights: make(map[string]*metadataFlight),
+		}
+	}
+	return k.metadata
+}
+
+// Names lists all topic names.
+func (md *Metadata) Names(ctx context.Context) (TopicNames, error) {
+	v, err := md.get(ctx, namesKey, func(ctx context.Context) (interface{}, error) {
+		return md.Kafka.NewTopics().NamesContext(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(TopicNames(nil), v.(TopicNames)...), nil
+}
+
+// Topic returns the Topic with provided topicName.
+func (md *Metadata) Topic(ctx context.Context, topicName string) (Topic, error) {
+	v, err := md.get(ctx, topicKeyPrefix+topicName, func(ctx context.Context) (interface{}, error) {
+		return md.Kafka.NewTopics().TopicContext(ctx, topicName)
+	})
+	if err != nil {
+		return Topic{}, err
+	}
+
+	return v.(Topic).clone(), nil
+}
+
+// Topics lists all topics, at most maxFanOut topics are fetched concurrently.
+// Topics deleted since their names are listed are left out.
+func (md *Metadata) Topics(ctx context.Context) ([]Topic, error) {
+	names, err := md.Names(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	topics := make([]Topic, len(names))
+	found := make([]bool, len(names))
+	err = fanOut(ctx, len(names), func(ctx context.Context, i int) error {
+		t, err := md.Topic(ctx, names[i])
+		switch {
+		case IsTopicNotFound(err):
+			return nil
+		case err != nil:
+			return err
+		}
+		topics[i], found[i] = t, true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	list := topics[:0]
+	for i, t := range topics {
+		if found[i] {
+			list = append(list, t)
+		}
+	}
+	return list, nil
+}
+
+// PartitionCount returns the number of partitions of the topic.
+func (md *Metadata) PartitionCount(ctx context.Context, topicName string) (int, error) {
+	t, err := md.Topic(ctx, topicName)
+	if err != nil {
+		return 0, err
+	}
+	return len(t.Partitions), nil
+}
+
+// Leader returns the leader broker of the partition, -1 if the partition has no leader.
+func (md *Metadata) Leader(ctx context.Context, topicName string, partition int) (int, error) {
+	t, err := md.Topic(ctx, topicName)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range t.Partitions {
+		if p.Partition == partition {
+			return p.Leader, nil
+		}
+	}
+	return 0, errors.Errorf("Error: partition %v not found for topic %v", partition, topicName)
+}
+
+// Invalidate forces the topics, or all the metadata if none is provided, to be fetched on next read.
+func (md *Metadata) Invalidate(topicName ...string) {
+	md.mu.Lock()
+	defer md.mu.Unlock()
+
+	invalidate := func(key string) {
+		if e, ok := md.entries[key]; ok {
+			md.entries[key] = &metadataEntry{value: e.value, fetch: e.fetch, fetched: e.fetched, invalid: true}
+		}
+	}
+
+	if len(topicName) == 0 {
+		for key := range md.entries {
+			invalidate(key)
+		}
+		return
+	}
+
+	invalidate(namesKey)
+	for _, tn := range topicName {
+		invalidate(topicKeyPrefix + tn)
+	}
+}
+
+// Refresh fetches all the metadata now.
+func (md *Metadata) Refresh(ctx context.Context) error {
+	md.Invalidate()
+	_, err := md.Topics(ctx)
+	return err
+}
+
+// AutoRefresh keeps fetching the cached entries every interval, default to Kafka.MetadataTTL if not positive,
+// until ctx is done or the returned func is called, so that reads do not wait for or serve stale entries.
+// It does nothing if caching is disabled. The returned func cancels refreshing and waits for it to stop.
+func (md *Metadata) AutoRefresh(ctx context.Context, interval time.Duration) func() {
+	if interval <= 0 {
+		interval = md.Kafka.MetadataTTL
+	}
+	if interval <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	cancelFunc := func() {
+		cancel()
+		<-done
+	}
+
+	go func() {
+		defer close(done)
+		for sleepContext(ctx, interval) {
+			md.mu.Lock()
+			keys := make([]string, 0, len(md.entries))
+			fetches := make([]func(context.Context) (interface{}, error), 0, len(md.entries))
+			for key, e := range md.entries {
+				keys, fetches = append(keys, key), append(fetches, e.fetch)
+			}
+			md.mu.Unlock()
+
+			// errors are left to the next reads, which fetch the entries again
+			fanOut(ctx, len(keys), func(ctx context.Context, i int) error {
+				md.refresh(ctx, keys[i], fetches[i])
+				return nil
+			})
+		}
+	}()
+
+	return cancelFunc
+}
+
+func (md *Metadata) get(ctx context.Context, key string, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+	ttl := md.Kafka.MetadataTTL
+
+	md.mu.Lock()
+	e := md.entries[key]
+	_, flying := md.flights[key]
+	md.mu.Unlock()
+
+	if e == nil || e.invalid || ttl <= 0 {
+		return md.refresh(ctx, key, fetch)
+	}
+
+	if time.Since(e.fetched) > ttl && !flying {
+		// serve the stale entry while it is refreshed
+		go md.refresh(context.WithoutCancel(ctx), key, fetch)
+	}
+
+	return e.value, nil
+}
+
+// refresh fetches the entry, or waits for the fetch in flight if any.
+func (md *Metadata) refresh(ctx context.Context, key string, fetch func(context.Context) (interface{}, error)) (interface{}, error) {
+	md.mu.Lock()
+	f, ok := md.flights[key]
+	if !ok {
+		f = &metadataFlight{done: make(chan struct{})}
+		md.flights[key] = f
+
+		// the fetch outlives the caller ctx as other callers may wait for it
+		go func(ctx context.Context) {
+			v, err := fetch(ctx)
+
+			md.mu.Lock()
+			switch {
+			case err == nil:
+				md.entries[key] = &metadataEntry{value: v, fetch: fetch, fetched: time.Now()}
+			case IsTopicNotFound(err):
+				delete(md.entries, key)
+			}
+			delete(md.flights, key)
+			f.value, f.err = v, err
+			md.mu.Unlock()
+
+			close(f.done)
+		}(context.WithoutCancel(ctx))
+	}
+	md.mu.Unlock()
+
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
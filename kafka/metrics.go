@@ -0,0 +1,99 @@
+package kafka
+
+import (
+	"net/http"
+	"time"
+)
+
+type (
+	// Metrics is notified of the activity of Kafka, e.g. to export it via package promkafka.
+	// Methods are called synchronously and must be safe for concurrent use.
+	Metrics interface {
+		// Request is called after each request with its Endpoint, the status code, 0 if it failed without response,
+		// and its duration until the response headers are received
+		Request(e Endpoint, statusCode int, duration time.Duration)
+		// Retry is called when an operation failed and is retried, e.g. "fetch" by Poll,
+		// "consumer_instance" when ManagedConsumer recreates an expired instance, "keep_alive" or "commit"
+		Retry(operation string)
+		// Produced is called after each produce to the topic, with the response or the error
+		Produced(topic string, message *ProducerMessage, pr *ProducerResponse, err error)
+		// Fetched is called after each fetch of the consumer group, with no messages for an empty poll, or the error
+		Fetched(group string, messages []Message, err error)
+		// Committed is called after each commit of the consumer group with its duration and error
+		Committed(group string, duration time.Duration, err error)
+		// Lag is called with each lag computed for the consumer group
+		Lag(group string, lag *ConsumerLag)
+		// InFlight is called with the number of messages of the consumer group being handled by ManagedConsumer,
+		// the size of the current batch
+		InFlight(group string, messages int)
+		// Uncommitted is called with the number of messages of the consumer group tracked by OffsetTracker
+		// which are not yet committable
+		Uncommitted(group string, messages int)
+	}
+
+	// NopMetrics implements Metrics doing nothing, to be embedded by Metrics implementing some of the methods only.
+	NopMetrics struct{}
+
+	metricsTransport struct {
+		metrics Metrics
+		base    http.RoundTripper
+	}
+)
+
+// Request implements Metrics.
+func (NopMetrics) Request(Endpoint, int, time.Duration) {}
+
+// Retry implements Metrics.
+func (NopMetrics) Retry(string) {}
+
+// Produced implements Metrics.
+func (NopMetrics) Produced(string, *ProducerMessage, *ProducerResponse, error) {}
+
+// Fetched implements Metrics.
+func (NopMetrics) Fetched(string, []Message, error) {}
+
+// Committed implements Metrics.
+func (NopMetrics) Committed(string, time.Duration, error) {}
+
+// Lag implements Metrics.
+func (NopMetrics) Lag(string, *ConsumerLag) {}
+
+// InFlight implements Metrics.
+func (NopMetrics) InFlight(string, int) {}
+
+// Uncommitted implements Metrics.
+func (NopMetrics) Uncommitted(string, int) {}
+
+// SetMetrics applies Metrics to Kafka.
+func SetMetrics(metrics Metrics) func(*Kafka) error {
+	return func(k *Kafka) error {
+		k.Metrics = metrics
+		return nil
+	}
+}
+
+// metrics returns Metrics, NopMetrics if nil.
+func (k *Kafka) metrics() Metrics {
+	if k.Metrics == nil {
+		return NopMetrics{}
+	}
+	return k.Metrics
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	e, ok := EndpointFrom(req.Context())
+	if !ok {
+		e = Endpoint{Name: req.Method, Partition: -1}
+	}
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	statusCode := 0
+	if err == nil {
+		statusCode = res.StatusCode
+	}
+	t.metrics.Request(e, statusCode, time.Since(start))
+
+	return res, err
+}
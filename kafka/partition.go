@@ -2,9 +2,10 @@ package kafka
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
+	"iter"
 	"net/http"
 	"strconv"
 
@@ -32,22 +33,35 @@ type (
 		Topic *Topic
 		List  []Partition
 	}
+
+	// PartitionOffsets are the beginning and end offsets of a partition
+	PartitionOffsets struct {
+		Partition       int   `json:"partition"`
+		BeginningOffset int64 `json:"beginning_offset"`
+		EndOffset       int64 `json:"end_offset"`
+	}
 )
 
 // Partitions lists partitions for the topic.
 func (ps *Partitions) Partitions(topicName ...string) ([]Partition, error) {
+	return ps.PartitionsContext(context.Background(), topicName...)
+}
+
+// PartitionsContext is like Partitions but with a context.
+func (ps *Partitions) PartitionsContext(ctx context.Context, topicName ...string) ([]Partition, error) {
 	tn, err := getTopicName(ps.Topic, topicName)
 	if err != nil {
 		return nil, err
 	}
 
 	client := ps.Kafka.HTTPClient()
-	url, err := URLJoin(ps.Kafka.URL, "topics", tn, "partitions")
+	url, err := topicURL(ps.Kafka.URL, tn, "partitions")
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /topics/{topic}/partitions", Topic: tn, Partition: -1})
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -66,8 +80,8 @@ func (ps *Partitions) Partitions(topicName ...string) ([]Partition, error) {
 
 	pss := []Partition{}
 
-	err = json.NewDecoder(res.Body).Decode(pss)
-	if err != nil && err != io.EOF {
+	err = ps.Kafka.decode(res, &pss)
+	if err != nil {
 		return nil, err
 	}
 
@@ -76,18 +90,24 @@ func (ps *Partitions) Partitions(topicName ...string) ([]Partition, error) {
 
 // Partition returns the Partition with provided partitionID.
 func (ps *Partitions) Partition(partitionID int, topicName ...string) (*Partition, error) {
+	return ps.PartitionContext(context.Background(), partitionID, topicName...)
+}
+
+// PartitionContext is like Partition but with a context.
+func (ps *Partitions) PartitionContext(ctx context.Context, partitionID int, topicName ...string) (*Partition, error) {
 	tn, err := getTopicName(ps.Topic, topicName)
 	if err != nil {
 		return nil, err
 	}
 
 	client := ps.Kafka.HTTPClient()
-	url, err := URLJoin(ps.Kafka.URL, "topics", tn, "partitions", strconv.Itoa(partitionID))
+	url, err := topicURL(ps.Kafka.URL, tn, "partitions", strconv.Itoa(partitionID))
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /topics/{topic}/partitions/{partition}", Topic: tn, Partition: partitionID})
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -106,8 +126,8 @@ func (ps *Partitions) Partition(partitionID int, topicName ...string) (*Partitio
 
 	p := &Partition{}
 
-	err = json.NewDecoder(res.Body).Decode(p)
-	if err != nil && err != io.EOF {
+	err = ps.Kafka.decode(res, p)
+	if err != nil {
 		return nil, err
 	}
 
@@ -115,7 +135,21 @@ func (ps *Partitions) Partition(partitionID int, topicName ...string) (*Partitio
 }
 
 // Produce post message to the Partition with provided id.
+// The id is checked against the partition count cached by Kafka.Metadata first, unless caching is disabled.
 func (ps *Partitions) Produce(id int, message *ProducerMessage, topicName ...string) (*ProducerResponse, error) {
+	return ps.ProduceContext(context.Background(), id, message, topicName...)
+}
+
+// ProduceContext is like Produce but with a context.
+func (ps *Partitions) ProduceContext(ctx context.Context, id int, message *ProducerMessage, topicName ...string) (*ProducerResponse, error) {
+	pr, err := ps.produce(ctx, id, message, topicName...)
+	tn, _ := getTopicName(ps.Topic, topicName)
+	ps.Kafka.metrics().Produced(tn, message, pr, err)
+	ps.Kafka.logProduced(ctx, tn, message, err)
+	return pr, err
+}
+
+func (ps *Partitions) produce(ctx context.Context, id int, message *ProducerMessage, topicName ...string) (*ProducerResponse, error) {
 	if ps.Kafka.Format == Avro && message.ValueSchema == "" && message.ValueSchemaID == 0 {
 		return nil, fmt.Errorf("Must provide a value schema or value schema id for Avro format")
 	}
@@ -125,15 +159,21 @@ func (ps *Partitions) Produce(id int, message *ProducerMessage, topicName ...str
 		return nil, err
 	}
 
+	err = ps.validatePartition(ctx, tn, id)
+	if err != nil {
+		return nil, err
+	}
+
 	client := ps.Kafka.HTTPClient()
-	url, err := URLJoin(ps.Kafka.URL, "topics", tn, "partitions", strconv.Itoa(id))
+	url, err := topicURL(ps.Kafka.URL, tn, "partitions", strconv.Itoa(id))
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "POST /topics/{topic}/partitions/{partition}", Topic: tn, Partition: id})
 
 	b := &bytes.Buffer{}
 	json.NewEncoder(b).Encode(message)
-	req, err := http.NewRequest("POST", url, b)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, b)
 	if err != nil {
 		return nil, err
 	}
@@ -148,16 +188,23 @@ func (ps *Partitions) Produce(id int, message *ProducerMessage, topicName ...str
 
 	err = validateStatusCode(res)
 	if err != nil {
+		if isStaleMetadata(err, nil) {
+			ps.Kafka.invalidateStale(ctx, tn)
+		}
 		return nil, err
 	}
 
 	pr := &ProducerResponse{}
 
-	err = json.NewDecoder(res.Body).Decode(pr)
-	if err != nil && err != io.EOF {
+	err = ps.Kafka.decode(res, pr)
+	if err != nil {
 		return nil, err
 	}
 
+	if isStaleMetadata(nil, pr) {
+		ps.Kafka.invalidateStale(ctx, tn)
+	}
+
 	cause, hasError := errors.New("Error: produce messages to partition "+strconv.Itoa(id)+"of topic"+tn), false
 	for _, offset := range pr.Offsets {
 		if offset.ErrorCode != 0 {
@@ -172,3 +219,173 @@ func (ps *Partitions) Produce(id int, message *ProducerMessage, topicName ...str
 
 	return pr, nil
 }
+
+// validatePartition checks the partition is below the partition count cached by the metadata of Kafka,
+// the topic is fetched again once in case partitions were added since. It does nothing if caching is disabled.
+func (ps *Partitions) validatePartition(ctx context.Context, topicName string, partition int) error {
+	if ps.Kafka.MetadataTTL <= 0 {
+		return nil
+	}
+
+	md := ps.Kafka.Metadata()
+	for i := 0; i < 2; i++ {
+		count, err := md.PartitionCount(ctx, topicName)
+		if err != nil {
+			return err
+		}
+		if partition >= 0 && partition < count {
+			return nil
+		}
+		if i == 0 {
+			md.Invalidate(topicName)
+		}
+	}
+	return errors.Errorf("Error: partition %v not found for topic %v", partition, topicName)
+}
+
+// Messages consumes messages from the partition starting at offset via the stateless simple consumer API,
+// without creating a consumer group. count is the maximum number of messages, default to 1 if 0.
+func (ps *Partitions) Messages(ctx context.Context, partition int, offset int64, count int, topicName ...string) ([]Message, error) {
+	tn, err := getTopicName(ps.Topic, topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := topicURL(ps.Kafka.URL, tn, "partitions", strconv.Itoa(partition), "messages")
+	if err != nil {
+		return nil, err
+	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /topics/{topic}/partitions/{partition}/messages", Topic: tn, Partition: partition})
+
+	requestHooker := func(req *http.Request) {
+		req.Header.Set("Accept", ps.Kafka.Accept)
+
+		q := req.URL.Query()
+		q.Add("offset", strconv.FormatInt(offset, 10))
+		if count != 0 {
+			q.Add("count", strconv.Itoa(count))
+		}
+		req.URL.RawQuery = q.Encode()
+	}
+
+	m := []Message{}
+
+	responseHooker := func(res *http.Response) error {
+		err := validateStatusCode(res)
+		if err != nil {
+			return err
+		}
+
+		err = ps.Kafka.decode(res, &m)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	err = doRequest(ctx, "GET", url, ps.Kafka.HTTPClient(), nil, requestHooker, responseHooker)
+	if err != nil {
+		return nil, err
+	}
+
+	// the response does not carry the topic
+	for i := range m {
+		m[i].Topic = tn
+		m[i].Partition = partition
+	}
+
+	return m, nil
+}
+
+// Range iterates over the messages of the partition from startOffset to endOffset (exclusive),
+// fetching pageSize messages per request, pageSize must be positive. A negative endOffset iterates up to
+// the current end of the partition. Messages below the next offset are skipped, iteration stops with an error
+// if a page does not advance it. Iteration stops at the first error, which is yielded with a zero Message.
+func (ps *Partitions) Range(ctx context.Context, partition int, startOffset, endOffset int64, pageSize int, topicName ...string) iter.Seq2[Message, error] {
+	return func(yield func(Message, error) bool) {
+		if pageSize <= 0 {
+			yield(Message{}, errors.New("Error: invalid pageSize"))
+			return
+		}
+
+		offset := startOffset
+		for endOffset < 0 || offset < endOffset {
+			count := pageSize
+			if endOffset >= 0 && int64(count) > endOffset-offset {
+				count = int(endOffset - offset)
+			}
+
+			messages, err := ps.Messages(ctx, partition, offset, count, topicName...)
+			if err != nil {
+				yield(Message{}, err)
+				return
+			}
+
+			if len(messages) == 0 {
+				// reached the end of the partition
+				return
+			}
+
+			next := offset
+			for _, m := range messages {
+				if m.Offset < next {
+					continue
+				}
+				if endOffset >= 0 && m.Offset >= endOffset {
+					return
+				}
+				if !yield(m, nil) {
+					return
+				}
+				next = m.Offset + 1
+			}
+
+			if next <= offset {
+				yield(Message{}, errors.Errorf("Error: offset %v of partition %v not advancing", offset, partition))
+				return
+			}
+			offset = next
+		}
+	}
+}
+
+// Offsets returns the beginning and end offsets of the partition via API v2.
+func (ps *Partitions) Offsets(ctx context.Context, partition int, topicName ...string) (*PartitionOffsets, error) {
+	tn, err := getTopicName(ps.Topic, topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	url, err := topicURL(ps.Kafka.URL, tn, "partitions", strconv.Itoa(partition), "offsets")
+	if err != nil {
+		return nil, err
+	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /topics/{topic}/partitions/{partition}/offsets", Topic: tn, Partition: partition})
+
+	requestHooker := func(req *http.Request) {
+		req.Header.Set("Accept", ps.Kafka.Accept)
+	}
+
+	po := &PartitionOffsets{}
+
+	responseHooker := func(res *http.Response) error {
+		err := validateStatusCode(res)
+		if err != nil {
+			return err
+		}
+
+		err = ps.Kafka.decode(res, po)
+		if err != nil {
+			return err
+		}
+		return nil
+	}
+
+	err = doRequest(ctx, "GET", url, ps.Kafka.HTTPClient(), nil, requestHooker, responseHooker)
+	if err != nil {
+		return nil, err
+	}
+
+	po.Partition = partition
+	return po, nil
+}
@@ -2,10 +2,11 @@ package kafka
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
+	"sort"
 
 	"github.com/pkg/errors"
 )
@@ -42,6 +43,14 @@ type (
 		Key       json.RawMessage `json:"key,omitempty"`
 		Value     json.RawMessage `json:"value"`
 		Partition int             `json:"partition,omitempty"`
+		// Headers are sent only if any, to proxies which support record headers
+		Headers []Header `json:"headers,omitempty"`
+	}
+
+	// Header is a record header, its Value is base64 encoded in JSON
+	Header struct {
+		Name  string `json:"name"`
+		Value []byte `json:"value"`
 	}
 
 	// ProducerResponse is the Topic / Partition response
@@ -60,33 +69,37 @@ type (
 	}
 )
 
-// Topics lists all topics.
+// Topics lists all topics, served from the metadata cache of Kafka.
 func (ts *Topics) Topics() ([]Topic, error) {
-	ns, err := ts.Names()
+	return ts.TopicsContext(context.Background())
+}
+
+// TopicsContext is like Topics but with a context.
+func (ts *Topics) TopicsContext(ctx context.Context) ([]Topic, error) {
+	list, err := ts.Kafka.Metadata().Topics(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, n := range ns {
-		t, err := ts.Topic(n)
-		if err != nil {
-			return ts.List, err
-		}
-		ts.List = append(ts.List, t)
-	}
-
+	ts.List = list
 	return ts.List, nil
 }
 
 // Names lists all topic names.
 func (ts *Topics) Names() (TopicNames, error) {
+	return ts.NamesContext(context.Background())
+}
+
+// NamesContext is like Names but with a context.
+func (ts *Topics) NamesContext(ctx context.Context) (TopicNames, error) {
 	client := ts.Kafka.HTTPClient()
 	url, err := URLJoin(ts.Kafka.URL, "topics")
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /topics", Partition: -1})
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -105,8 +118,8 @@ func (ts *Topics) Names() (TopicNames, error) {
 
 	var tn TopicNames
 
-	err = json.NewDecoder(res.Body).Decode(&tn)
-	if err != nil && err != io.EOF {
+	err = ts.Kafka.decode(res, &tn)
+	if err != nil {
 		return nil, err
 	}
 
@@ -115,13 +128,19 @@ func (ts *Topics) Names() (TopicNames, error) {
 
 // Topic returns the Topic with provided topicName.
 func (ts *Topics) Topic(topicName string) (Topic, error) {
+	return ts.TopicContext(context.Background(), topicName)
+}
+
+// TopicContext is like Topic but with a context.
+func (ts *Topics) TopicContext(ctx context.Context, topicName string) (Topic, error) {
 	client := ts.Kafka.HTTPClient()
-	url, err := URLJoin(ts.Kafka.URL, "topics", topicName)
+	url, err := topicURL(ts.Kafka.URL, topicName)
 	if err != nil {
 		return Topic{}, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "GET /topics/{topic}", Topic: topicName, Partition: -1})
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return Topic{}, err
 	}
@@ -140,8 +159,8 @@ func (ts *Topics) Topic(topicName string) (Topic, error) {
 
 	t := Topic{}
 
-	err = json.NewDecoder(res.Body).Decode(&t)
-	if err != nil && err != io.EOF {
+	err = ts.Kafka.decode(res, &t)
+	if err != nil {
 		return Topic{}, err
 	}
 
@@ -150,19 +169,32 @@ func (ts *Topics) Topic(topicName string) (Topic, error) {
 
 // Produce post message to the Topic with provided topicName.
 func (ts *Topics) Produce(topicName string, message *ProducerMessage) (*ProducerResponse, error) {
+	return ts.ProduceContext(context.Background(), topicName, message)
+}
+
+// ProduceContext is like Produce but with a context.
+func (ts *Topics) ProduceContext(ctx context.Context, topicName string, message *ProducerMessage) (*ProducerResponse, error) {
+	pr, err := ts.produce(ctx, topicName, message)
+	ts.Kafka.metrics().Produced(topicName, message, pr, err)
+	ts.Kafka.logProduced(ctx, topicName, message, err)
+	return pr, err
+}
+
+func (ts *Topics) produce(ctx context.Context, topicName string, message *ProducerMessage) (*ProducerResponse, error) {
 	if ts.Kafka.Format == Avro && message.ValueSchema == "" && message.ValueSchemaID == 0 {
 		return nil, fmt.Errorf("Must provide a value schema or value schema id for Avro format")
 	}
 
 	client := ts.Kafka.HTTPClient()
-	url, err := URLJoin(ts.Kafka.URL, "topics", topicName)
+	url, err := topicURL(ts.Kafka.URL, topicName)
 	if err != nil {
 		return nil, err
 	}
+	ctx = withEndpoint(ctx, Endpoint{Name: "POST /topics/{topic}", Topic: topicName, Partition: -1})
 
 	b := &bytes.Buffer{}
 	json.NewEncoder(b).Encode(message)
-	req, err := http.NewRequest("POST", url, b)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, b)
 	if err != nil {
 		return nil, err
 	}
@@ -177,16 +209,23 @@ func (ts *Topics) Produce(topicName string, message *ProducerMessage) (*Producer
 
 	err = validateStatusCode(res)
 	if err != nil {
+		if isStaleMetadata(err, nil) {
+			ts.Kafka.invalidateStale(ctx, topicName)
+		}
 		return nil, err
 	}
 
 	pr := &ProducerResponse{}
 
-	err = json.NewDecoder(res.Body).Decode(pr)
-	if err != nil && err != io.EOF {
+	err = ts.Kafka.decode(res, pr)
+	if err != nil {
 		return nil, err
 	}
 
+	if isStaleMetadata(nil, pr) {
+		ts.Kafka.invalidateStale(ctx, topicName)
+	}
+
 	cause, hasError := errors.New("Error: produce messages to topic "+topicName), false
 	for _, offset := range pr.Offsets {
 		if offset.ErrorCode != 0 {
@@ -202,6 +241,47 @@ func (ts *Topics) Produce(topicName string, message *ProducerMessage) (*Producer
 	return pr, nil
 }
 
+// Watermarks returns the beginning and end offsets of all the partitions of the topic via API v2,
+// the partitions are queried concurrently.
+func (ts *Topics) Watermarks(ctx context.Context, topicName string) ([]PartitionOffsets, error) {
+	ps := ts.NewPartitions()
+	partitions, err := ps.PartitionsContext(ctx, topicName)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int, len(partitions))
+	for i, p := range partitions {
+		ids[i] = p.Partition
+	}
+
+	watermarks := make([]PartitionOffsets, len(ids))
+	err = fanOut(ctx, len(ids), func(ctx context.Context, i int) error {
+		po, err := ps.Offsets(ctx, ids[i], topicName)
+		if err != nil {
+			return err
+		}
+		watermarks[i] = *po
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(watermarks, func(i, j int) bool { return watermarks[i].Partition < watermarks[j].Partition })
+	return watermarks, nil
+}
+
+// clone returns a deep copy of the topic.
+func (t Topic) clone() Topic {
+	t.Configs = append(json.RawMessage(nil), t.Configs...)
+	t.Partitions = append([]Partition(nil), t.Partitions...)
+	for i := range t.Partitions {
+		t.Partitions[i].Replicas = append([]Replica(nil), t.Partitions[i].Replicas...)
+	}
+	return t
+}
+
 // NewPartitions returns a Partitions instance.
 func (ts *Topics) NewPartitions(t ...*Topic) *Partitions {
 	ps := Partitions{
@@ -0,0 +1,207 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+type (
+	// OffsetTracker records in-flight and completed offsets per topic partition for at-least-once delivery.
+	// Only the highest contiguous completed offset plus one is committed for each topic partition,
+	// so that messages handled concurrently never let a commit skip an uncompleted message.
+	// It requires API v2, API v1 commits all the offsets consumed by the instance regardless.
+	// An OffsetTracker is safe for concurrent use by multiple goroutines.
+	OffsetTracker struct {
+		Consumers     *Consumers
+		ConsumerName  string
+		ConsumerGroup string
+		// Interval is the periodic commit interval for Run. Default to 5s.
+		Interval time.Duration
+		// OnError (optional) is called when a periodic commit fails, it is retried on the next tick.
+		OnError func(error)
+
+		mu         sync.Mutex
+		commitMu   sync.Mutex
+		partitions map[ConsumerPartitions]*partitionOffsets
+		// inFlight is the number of pending offsets of all partitions
+		inFlight int
+	}
+
+	partitionOffsets struct {
+		// pending are the tracked offsets not yet part of the contiguous completed prefix, in ascending order
+		pending   []int64
+		completed map[int64]bool
+		// next is the offset to commit, committed is the last committed one
+		next      int64
+		committed int64
+	}
+)
+
+const defaultCommitInterval = 5 * time.Second
+
+// NewOffsetTracker returns an OffsetTracker instance for the consumer instance.
+func (cs *Consumers) NewOffsetTracker(consumerName string, consumerGroup ...string) *OffsetTracker {
+	ot := OffsetTracker{
+		Consumers:     cs,
+		ConsumerName:  consumerName,
+		ConsumerGroup: cs.ConsumerGroup,
+		partitions:    make(map[ConsumerPartitions]*partitionOffsets),
+	}
+
+	if len(consumerGroup) > 0 {
+		ot.ConsumerGroup = consumerGroup[0]
+	}
+
+	return &ot
+}
+
+// Track records messages as in-flight, it must be called in fetch order before they are handed out.
+func (ot *OffsetTracker) Track(messages ...Message) {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	for _, m := range messages {
+		po := ot.partition(m)
+		if n := len(po.pending); m.Offset < po.next || (n > 0 && m.Offset <= po.pending[n-1]) {
+			// already tracked, e.g. redelivered after a seek
+			continue
+		}
+		po.pending = append(po.pending, m.Offset)
+		ot.inFlight++
+	}
+	ot.Consumers.Kafka.metrics().Uncommitted(ot.ConsumerGroup, ot.inFlight)
+}
+
+// Done records messages as completed, the committable offset advances once all tracked messages before them are done.
+func (ot *OffsetTracker) Done(messages ...Message) {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	for _, m := range messages {
+		po := ot.partition(m)
+		i := sort.Search(len(po.pending), func(i int) bool { return po.pending[i] >= m.Offset })
+		if i == len(po.pending) || po.pending[i] != m.Offset {
+			// not tracked
+			continue
+		}
+		po.completed[m.Offset] = true
+
+		for len(po.pending) > 0 && po.completed[po.pending[0]] {
+			delete(po.completed, po.pending[0])
+			po.next = po.pending[0] + 1
+			po.pending = po.pending[1:]
+			ot.inFlight--
+		}
+	}
+	ot.Consumers.Kafka.metrics().Uncommitted(ot.ConsumerGroup, ot.inFlight)
+}
+
+// InFlight returns the number of tracked messages not yet committable.
+func (ot *OffsetTracker) InFlight() int {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	return ot.inFlight
+}
+
+// Offsets returns the committable offsets which are not committed yet.
+func (ot *OffsetTracker) Offsets() *ConsumerOffsets {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	consumerOffsets := &ConsumerOffsets{}
+	for tp, po := range ot.partitions {
+		if po.next > po.committed {
+			consumerOffsets.Offsets = append(consumerOffsets.Offsets, ConsumerOffset{
+				Topic:     tp.Topic,
+				Partition: tp.Partition,
+				Offset:    po.next,
+			})
+		}
+	}
+
+	sort.Slice(consumerOffsets.Offsets, func(i, j int) bool {
+		a, b := consumerOffsets.Offsets[i], consumerOffsets.Offsets[j]
+		return a.Topic < b.Topic || (a.Topic == b.Topic && a.Partition < b.Partition)
+	})
+
+	return consumerOffsets
+}
+
+// Commit commits the committable offsets via Consumers.CommitOffsets, if any.
+func (ot *OffsetTracker) Commit(ctx context.Context) error {
+	ot.commitMu.Lock()
+	defer ot.commitMu.Unlock()
+
+	consumerOffsets := ot.Offsets()
+	if len(consumerOffsets.Offsets) == 0 {
+		return nil
+	}
+
+	err := ot.Consumers.CommitOffsetsContext(ctx, consumerOffsets, ot.ConsumerName, ot.ConsumerGroup)
+	if err != nil {
+		return err
+	}
+
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	for _, co := range consumerOffsets.Offsets {
+		po, ok := ot.partitions[ConsumerPartitions{Topic: co.Topic, Partition: co.Partition}]
+		if ok && co.Offset > po.committed {
+			po.committed = co.Offset
+		}
+	}
+
+	return nil
+}
+
+// Run commits periodically every Interval until ctx is done, then it commits a last time on shutdown.
+// Run returns the error of the last commit.
+func (ot *OffsetTracker) Run(ctx context.Context) error {
+	interval := ot.Interval
+	if interval <= 0 {
+		interval = defaultCommitInterval
+	}
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ot.Commit(context.WithoutCancel(ctx))
+		case <-t.C:
+		}
+
+		if err := ot.Commit(ctx); err != nil && ctx.Err() == nil {
+			ot.Consumers.Kafka.retry(ctx, "commit", err, slog.String("group", ot.ConsumerGroup), slog.String("instance", ot.ConsumerName))
+			if ot.OnError != nil {
+				ot.OnError(err)
+			}
+		}
+	}
+}
+
+// Reset forgets all tracked offsets, e.g. after the consumer instance is recreated or partitions are reassigned.
+func (ot *OffsetTracker) Reset() {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+
+	ot.partitions = make(map[ConsumerPartitions]*partitionOffsets)
+	ot.inFlight = 0
+	ot.Consumers.Kafka.metrics().Uncommitted(ot.ConsumerGroup, 0)
+}
+
+func (ot *OffsetTracker) partition(m Message) *partitionOffsets {
+	tp := ConsumerPartitions{Topic: m.Topic, Partition: m.Partition}
+	po, ok := ot.partitions[tp]
+	if !ok {
+		po = &partitionOffsets{completed: make(map[int64]bool)}
+		ot.partitions[tp] = po
+	}
+	return po
+}
@@ -0,0 +1,177 @@
+package kafka
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type (
+	// TopicEventType is the type of TopicEvent
+	TopicEventType string
+
+	// TopicEvent is a change of topic or partition found by Topics.Watch
+	TopicEvent struct {
+		Type  TopicEventType `json:"type"`
+		Topic string         `json:"topic"`
+		// Partition is set for LeaderChanged and ReplicaOutOfSync
+		Partition int `json:"partition"`
+		// PreviousPartitions and Partitions are the partition counts for PartitionsAdded
+		PreviousPartitions int `json:"previous_partitions"`
+		Partitions         int `json:"partitions"`
+		// PreviousLeader and Leader are the leader brokers for LeaderChanged
+		PreviousLeader int `json:"previous_leader"`
+		Leader         int `json:"leader"`
+		// Broker is the replica broker for ReplicaOutOfSync
+		Broker int `json:"broker"`
+	}
+)
+
+const (
+	// TopicCreated is emitted for a new topic
+	TopicCreated = TopicEventType("topic_created")
+	// TopicDeleted is emitted for a topic which no longer exists
+	TopicDeleted = TopicEventType("topic_deleted")
+	// PartitionsAdded is emitted when the partition count of a topic increases
+	PartitionsAdded = TopicEventType("partitions_added")
+	// LeaderChanged is emitted when the leader of a partition changes
+	LeaderChanged = TopicEventType("leader_changed")
+	// ReplicaOutOfSync is emitted when a replica of a partition falls out of the in-sync replicas
+	ReplicaOutOfSync = TopicEventType("replica_out_of_sync")
+)
+
+const defaultWatchInterval = 30 * time.Second
+
+// Watch fetches all the topics every interval, default to 30s if not positive, until ctx is done, and sends the changes between successive snapshots
+// on the returned event channel. The first snapshot is the baseline, it emits no event.
+// Errors of failed fetches are sent on the returned error channel, watching pauses until they are received.
+// Both channels are closed after ctx is done. The metadata cache of Kafka is refreshed on every fetch.
+func (ts *Topics) Watch(ctx context.Context, interval time.Duration) (<-chan TopicEvent, <-chan error) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+
+	events := make(chan TopicEvent)
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+		defer close(events)
+
+		md := ts.Kafka.Metadata()
+		var prev map[string]Topic
+		for {
+			md.Invalidate()
+			list, err := md.Topics(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+			} else {
+				next := make(map[string]Topic, len(list))
+				for _, t := range list {
+					next[t.Name] = t
+				}
+
+				if prev != nil {
+					for _, e := range diffTopics(prev, next) {
+						select {
+						case events <- e:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+				prev = next
+			}
+
+			if !sleepContext(ctx, interval) {
+				return
+			}
+		}
+	}()
+
+	return events, errs
+}
+
+// diffTopics returns the events between two snapshots, in topic name order.
+func diffTopics(prev, next map[string]Topic) []TopicEvent {
+	names := make([]string, 0, len(prev)+len(next))
+	for name := range prev {
+		names = append(names, name)
+	}
+	for name := range next {
+		if _, ok := prev[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var events []TopicEvent
+	for _, name := range names {
+		p, inPrev := prev[name]
+		n, inNext := next[name]
+		switch {
+		case !inPrev:
+			events = append(events, TopicEvent{Type: TopicCreated, Topic: name, Partitions: len(n.Partitions)})
+			continue
+		case !inNext:
+			events = append(events, TopicEvent{Type: TopicDeleted, Topic: name})
+			continue
+		}
+
+		if len(n.Partitions) > len(p.Partitions) {
+			events = append(events, TopicEvent{
+				Type:               PartitionsAdded,
+				Topic:              name,
+				PreviousPartitions: len(p.Partitions),
+				Partitions:         len(n.Partitions),
+			})
+		}
+
+		prevPartitions := make(map[int]Partition, len(p.Partitions))
+		for _, pp := range p.Partitions {
+			prevPartitions[pp.Partition] = pp
+		}
+
+		for _, np := range n.Partitions {
+			pp, ok := prevPartitions[np.Partition]
+			if !ok {
+				continue
+			}
+
+			if pp.Leader != np.Leader {
+				events = append(events, TopicEvent{
+					Type:           LeaderChanged,
+					Topic:          name,
+					Partition:      np.Partition,
+					PreviousLeader: pp.Leader,
+					Leader:         np.Leader,
+				})
+			}
+
+			inSync := make(map[int]bool, len(pp.Replicas))
+			for _, r := range pp.Replicas {
+				inSync[r.Broker] = r.InSync
+			}
+			for _, r := range np.Replicas {
+				if wasInSync, ok := inSync[r.Broker]; ok && wasInSync && !r.InSync {
+					events = append(events, TopicEvent{
+						Type:      ReplicaOutOfSync,
+						Topic:     name,
+						Partition: np.Partition,
+						Broker:    r.Broker,
+					})
+				}
+			}
+		}
+	}
+
+	return events
+}
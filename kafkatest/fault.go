@@ -0,0 +1,152 @@
+package kafkatest
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+)
+
+type (
+	// Fault is a failure injected into requests to the Server.
+	// A request matching Endpoint is faulted after the first After of them, at most Times times if positive,
+	// with Probability if in (0, 1). Latency applies before the request is handled, then in order:
+	// ExpireInstance deletes the consumer instance of the request, which then fails with 40403,
+	// StatusCode responds with an error instead of handling the request, FailRecords fail records of a produce
+	// request, and Drop closes the connection midway through the response of the handled request.
+	Fault struct {
+		// Endpoint is the route pattern of faulted requests, e.g. "POST /topics/{topic}", or the path pattern only
+		// for any method, e.g. "/consumers/{group}/instances/{instance}/records". All requests if empty.
+		Endpoint    string
+		After       int
+		Times       int
+		Probability float64
+
+		Latency        time.Duration
+		ExpireInstance bool
+		// StatusCode, ErrorCode and Message are the error response, Message defaults to the status text
+		StatusCode int
+		ErrorCode  int
+		Message    string
+		// RetryAfter sets the Retry-After header of the error response, e.g. for 429 throttling
+		RetryAfter time.Duration
+		// FailRecords are the indexes of records of a produce request which fail with RecordErrorCode,
+		// default to K.ProducerErrCodeRetriable, and RecordError, the others are appended
+		FailRecords     []int
+		RecordErrorCode int64
+		RecordError     string
+		Drop            bool
+
+		matched int
+		applied atomic.Int64
+	}
+
+	faultKey struct{}
+)
+
+// SetSeed seeds the source of fault probabilities, default to 1 so that runs are repeatable.
+func SetSeed(seed int64) func(*Server) error {
+	return func(s *Server) error {
+		s.rand = rand.New(rand.NewSource(seed))
+		return nil
+	}
+}
+
+// Inject adds faults to the Server, the first fault which applies to a request is injected.
+func (s *Server) Inject(faults ...*Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, faults...)
+}
+
+// ClearFaults removes all faults from the Server.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Applied returns how many times the fault has been injected.
+func (f *Fault) Applied() int {
+	return int(f.applied.Load())
+}
+
+// fault returns the fault to inject into the request, if any.
+func (s *Server) fault(r *http.Request) *Fault {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, f := range s.faults {
+		if !f.matches(r) {
+			continue
+		}
+
+		f.matched++
+		if f.matched <= f.After {
+			continue
+		}
+		if f.Times > 0 && f.Applied() >= f.Times {
+			continue
+		}
+		if f.Probability > 0 && f.Probability < 1 && s.rand.Float64() >= f.Probability {
+			continue
+		}
+
+		f.applied.Add(1)
+		return f
+	}
+	return nil
+}
+
+func (f *Fault) matches(r *http.Request) bool {
+	if f.Endpoint == "" || f.Endpoint == r.Pattern {
+		return true
+	}
+	// the pattern without its method
+	_, path, ok := strings.Cut(r.Pattern, " ")
+	return ok && f.Endpoint == path
+}
+
+// recordError returns the error code and message of the record at index of a produce request, if it fails.
+func (f *Fault) recordError(index int) (int64, string, bool) {
+	for _, i := range f.FailRecords {
+		if i != index {
+			continue
+		}
+
+		code, message := f.RecordErrorCode, f.RecordError
+		if code == 0 {
+			code = K.ProducerErrCodeRetriable
+		}
+		if message == "" {
+			message = "This server is not the leader for that topic-partition."
+		}
+		return code, message, true
+	}
+	return 0, "", false
+}
+
+// sleep waits for Latency, false if the request is canceled meanwhile.
+func (f *Fault) sleep(ctx context.Context) bool {
+	if f.Latency <= 0 {
+		return true
+	}
+
+	t := time.NewTimer(f.Latency)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func faultFrom(r *http.Request) *Fault {
+	f, _ := r.Context().Value(faultKey{}).(*Fault)
+	return f
+}
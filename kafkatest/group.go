@@ -0,0 +1,140 @@
+package kafkatest
+
+import (
+	"regexp"
+	"sort"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+)
+
+type (
+	group struct {
+		name      string
+		instances map[string]*instance
+		committed map[K.ConsumerPartitions]K.ConsumerOffset
+	}
+
+	instance struct {
+		name    string
+		request K.ConsumerRequest
+		// topics or pattern is the subscription, assigned is the manual assignment, mutually exclusive
+		topics   []string
+		pattern  *regexp.Regexp
+		assigned []K.ConsumerPartitions
+		// positions are the offsets to fetch next of the partitions the instance has
+		positions map[K.ConsumerPartitions]int64
+		lastUsed  time.Time
+	}
+)
+
+func newGroup(name string) *group {
+	return &group{
+		name:      name,
+		instances: map[string]*instance{},
+		committed: map[K.ConsumerPartitions]K.ConsumerOffset{},
+	}
+}
+
+func (i *instance) subscribed() bool {
+	return len(i.topics) > 0 || i.pattern != nil
+}
+
+func (i *instance) subscribes(topicName string) bool {
+	if i.pattern != nil {
+		return i.pattern.MatchString(topicName)
+	}
+	for _, t := range i.topics {
+		if t == topicName {
+			return true
+		}
+	}
+	return false
+}
+
+// expire deletes the instances which have not been used within timeout.
+func (g *group) expire(timeout time.Duration, now time.Time) {
+	if timeout <= 0 {
+		return
+	}
+	for name, i := range g.instances {
+		if now.Sub(i.lastUsed) > timeout {
+			delete(g.instances, name)
+		}
+	}
+}
+
+// rebalance assigns the partitions of the subscribed topics round robin to the subscribed instances in name order,
+// and updates their positions. Newly assigned partitions start from the committed offset, or by auto.offset.reset.
+func (g *group) rebalance(s *Server) {
+	var members []*instance
+	for _, i := range g.instances {
+		if i.subscribed() {
+			members = append(members, i)
+		}
+	}
+	sort.Slice(members, func(a, b int) bool { return members[a].name < members[b].name })
+
+	assignments := map[*instance][]K.ConsumerPartitions{}
+	for _, topicName := range s.topicNames() {
+		var subscribers []*instance
+		for _, i := range members {
+			if i.subscribes(topicName) {
+				subscribers = append(subscribers, i)
+			}
+		}
+		if len(subscribers) == 0 {
+			continue
+		}
+		for p := range s.topics[topicName].partitions {
+			i := subscribers[p%len(subscribers)]
+			assignments[i] = append(assignments[i], K.ConsumerPartitions{Topic: topicName, Partition: p})
+		}
+	}
+
+	for _, i := range g.instances {
+		tps := i.assigned
+		if i.subscribed() {
+			tps = assignments[i]
+		}
+		g.reposition(s, i, tps)
+	}
+}
+
+// reposition keeps the positions of the partitions which exist in tps only, adding the new ones.
+func (g *group) reposition(s *Server, i *instance, tps []K.ConsumerPartitions) {
+	positions := make(map[K.ConsumerPartitions]int64, len(tps))
+	for _, tp := range tps {
+		t, ok := s.topics[tp.Topic]
+		if !ok || tp.Partition < 0 || tp.Partition >= len(t.partitions) {
+			continue
+		}
+
+		if offset, ok := i.positions[tp]; ok {
+			positions[tp] = offset
+			continue
+		}
+
+		switch co, ok := g.committed[tp]; {
+		case ok:
+			positions[tp] = co.Offset
+		case i.request.Offset == K.Earliest || i.request.Offset == K.Smallest:
+			positions[tp] = 0
+		default:
+			positions[tp] = int64(len(t.partitions[tp.Partition].log))
+		}
+	}
+	i.positions = positions
+}
+
+// assignment returns the partitions the instance has in order.
+func (i *instance) assignment() []K.ConsumerPartitions {
+	tps := make([]K.ConsumerPartitions, 0, len(i.positions))
+	for tp := range i.positions {
+		tps = append(tps, tp)
+	}
+	sort.Slice(tps, func(a, b int) bool {
+		return tps[a].Topic < tps[b].Topic || (tps[a].Topic == tps[b].Topic && tps[a].Partition < tps[b].Partition)
+	})
+	return tps
+}
@@ -0,0 +1,710 @@
+package kafkatest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/pkg/errors"
+)
+
+const (
+	// errCodeConsumerInstanceExists is the error code for creating a consumer instance whose name is taken
+	errCodeConsumerInstanceExists = 40902
+	// errCodeIllegalState is the error code for mixing subscriptions and assignments, or seeking unassigned partitions
+	errCodeIllegalState = 40903
+	// errCodeInvalidConsumerConfig is the error code for an invalid consumer request
+	errCodeInvalidConsumerConfig = 42204
+)
+
+type (
+	// handlerFunc handles a request with the Server locked, returning the status code and the body to respond with.
+	handlerFunc func(r *http.Request) (int, interface{}, error)
+
+	produceRequest struct {
+		KeySchema     string          `json:"key_schema"`
+		KeySchemaID   int             `json:"key_schema_id"`
+		ValueSchema   string          `json:"value_schema"`
+		ValueSchemaID int             `json:"value_schema_id"`
+		Records       []produceRecord `json:"records"`
+	}
+
+	produceRecord struct {
+		Key       json.RawMessage `json:"key"`
+		Value     json.RawMessage `json:"value"`
+		Partition *int            `json:"partition"`
+		Headers   []K.Header      `json:"headers"`
+	}
+
+	subscriptionRequest struct {
+		Topics       []string `json:"topics"`
+		TopicPattern string   `json:"topic_pattern"`
+	}
+)
+
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	routes := map[string]handlerFunc{
+		"GET /brokers":                                        s.brokers,
+		"GET /topics":                                         s.names,
+		"GET /topics/{topic}":                                 s.topicMetadata,
+		"POST /topics/{topic}":                                s.produceTopic,
+		"GET /topics/{topic}/partitions":                      s.partitions,
+		"GET /topics/{topic}/partitions/{partition}":          s.partitionMetadata,
+		"POST /topics/{topic}/partitions/{partition}":         s.producePartition,
+		"GET /topics/{topic}/partitions/{partition}/messages": s.partitionMessages,
+		"GET /topics/{topic}/partitions/{partition}/offsets":  s.partitionOffsets,
+
+		"POST /consumers/{group}":                                          s.newConsumer,
+		"DELETE /consumers/{group}/instances/{instance}":                   s.deleteConsumer,
+		"POST /consumers/{group}/instances/{instance}/offsets":             s.commitOffsets,
+		"GET /consumers/{group}/instances/{instance}/offsets":              s.committedOffsets,
+		"POST /consumers/{group}/instances/{instance}/subscription":        s.subscribe,
+		"GET /consumers/{group}/instances/{instance}/subscription":         s.subscriptions,
+		"DELETE /consumers/{group}/instances/{instance}/subscription":      s.unsubscribe,
+		"POST /consumers/{group}/instances/{instance}/assignments":         s.assign,
+		"GET /consumers/{group}/instances/{instance}/assignments":          s.assignments,
+		"POST /consumers/{group}/instances/{instance}/positions":           s.seek,
+		"POST /consumers/{group}/instances/{instance}/positions/beginning": s.seekToBeginning,
+		"POST /consumers/{group}/instances/{instance}/positions/end":       s.seekToEnd,
+		"GET /consumers/{group}/instances/{instance}/records":              s.records,
+		"GET /consumers/{group}/instances/{instance}/topics/{topic}":       s.messages,
+
+		"/": func(*http.Request) (int, interface{}, error) {
+			return 0, nil, apiError(http.StatusNotFound, http.StatusNotFound, "HTTP 404 Not Found")
+		},
+	}
+	for pattern, fn := range routes {
+		mux.Handle(pattern, s.serve(fn))
+	}
+
+	return mux
+}
+
+// serve injects the fault of the request if any, locks the Server for fn and writes its response,
+// as JSON in the media type the request accepts.
+func (s *Server) serve(fn handlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f := s.fault(r)
+		if f != nil {
+			if !f.sleep(r.Context()) {
+				return
+			}
+			if f.ExpireInstance {
+				s.expireInstance(r)
+			}
+			if f.StatusCode != 0 {
+				message := f.Message
+				if message == "" {
+					message = http.StatusText(f.StatusCode)
+				}
+				if f.RetryAfter > 0 {
+					w.Header().Set("Retry-After", strconv.Itoa(int((f.RetryAfter+time.Second-1)/time.Second)))
+				}
+				write(w, r, 0, nil, apiError(f.StatusCode, f.ErrorCode, message), false)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), faultKey{}, f))
+		}
+
+		s.mu.Lock()
+		status, body, err := fn(r)
+		s.mu.Unlock()
+
+		write(w, r, status, body, err, f != nil && f.Drop)
+	})
+}
+
+// write writes the response, only half of it before closing the connection if drop.
+func write(w http.ResponseWriter, r *http.Request, status int, body interface{}, err error, drop bool) {
+	if err != nil {
+		apiErr, ok := errors.Cause(err).(*K.APIError)
+		if !ok {
+			apiErr = apiError(http.StatusInternalServerError, 50001, err.Error())
+		}
+		status, body = apiErr.StatusCode, apiErr.ErrorMessage
+	}
+
+	var b []byte
+	if body != nil {
+		b, _ = json.Marshal(body)
+		b = append(b, '\n')
+	}
+
+	w.Header().Set("Content-Type", contentType(r))
+	if !drop {
+		w.WriteHeader(status)
+		w.Write(b)
+		return
+	}
+
+	if len(b) > 0 {
+		w.Header().Set("Content-Length", strconv.Itoa(len(b)))
+		w.WriteHeader(status)
+		w.Write(b[:len(b)/2])
+		http.NewResponseController(w).Flush()
+	}
+	// closes the connection without completing the response
+	panic(http.ErrAbortHandler)
+}
+
+func apiError(statusCode, errorCode int, message string) *K.APIError {
+	return &K.APIError{
+		StatusCode:   statusCode,
+		Status:       fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		ErrorMessage: K.ErrorMessage{ErrorCode: errorCode, Message: message},
+	}
+}
+
+// contentType returns the first Kafka media type the request accepts, or the v2 one.
+func contentType(r *http.Request) string {
+	accept := strings.TrimSpace(strings.Split(r.Header.Get("Accept"), ",")[0])
+	if strings.HasPrefix(accept, "application/vnd.kafka") {
+		return accept
+	}
+	return "application/vnd.kafka.v2+json"
+}
+
+// decode decodes the request body into v, an empty body leaves v as is.
+func decode(r *http.Request, v interface{}) error {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err != nil && err != io.EOF {
+		return apiError(http.StatusBadRequest, http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+func (s *Server) brokers(*http.Request) (int, interface{}, error) {
+	return http.StatusOK, K.Broker{Brokers: s.Brokers}, nil
+}
+
+func (s *Server) names(*http.Request) (int, interface{}, error) {
+	return http.StatusOK, s.topicNames(), nil
+}
+
+func (s *Server) existingTopic(r *http.Request) (*topic, error) {
+	t, ok := s.topics[r.PathValue("topic")]
+	if !ok {
+		return nil, apiError(http.StatusNotFound, K.ErrCodeTopicNotFound, "Topic not found.")
+	}
+	return t, nil
+}
+
+func (s *Server) existingPartition(r *http.Request) (*topic, *partition, error) {
+	t, err := s.existingTopic(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := strconv.Atoi(r.PathValue("partition"))
+	if err != nil || id < 0 || id >= len(t.partitions) {
+		return nil, nil, apiError(http.StatusNotFound, K.ErrCodePartitionNotFound, "Partition not found.")
+	}
+	return t, t.partitions[id], nil
+}
+
+func (s *Server) topicMetadata(r *http.Request) (int, interface{}, error) {
+	t, err := s.existingTopic(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, t.metadata(), nil
+}
+
+func (s *Server) partitions(r *http.Request) (int, interface{}, error) {
+	t, err := s.existingTopic(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, t.metadata().Partitions, nil
+}
+
+func (s *Server) partitionMetadata(r *http.Request) (int, interface{}, error) {
+	_, p, err := s.existingPartition(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, p.metadata(), nil
+}
+
+func (s *Server) produceTopic(r *http.Request) (int, interface{}, error) {
+	t, err := s.topic(r.PathValue("topic"))
+	if err != nil {
+		return 0, nil, err
+	}
+	return s.produce(r, t, -1)
+}
+
+func (s *Server) producePartition(r *http.Request) (int, interface{}, error) {
+	t, p, err := s.existingPartition(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return s.produce(r, t, p.id)
+}
+
+// produce appends the records of the request to partition, or to the record partitions,
+// or to partitions chosen by key if partition is negative.
+func (s *Server) produce(r *http.Request, t *topic, partition int) (int, interface{}, error) {
+	var pr produceRequest
+	if err := decode(r, &pr); err != nil {
+		return 0, nil, err
+	}
+
+	for _, rec := range pr.Records {
+		if partition < 0 && rec.Partition != nil && (*rec.Partition < 0 || *rec.Partition >= len(t.partitions)) {
+			return 0, nil, apiError(http.StatusNotFound, K.ErrCodePartitionNotFound, "Partition not found.")
+		}
+	}
+
+	res := K.ProducerResponse{
+		KeySchemaID:   s.schemaID(pr.KeySchema, pr.KeySchemaID),
+		ValueSchemaID: s.schemaID(pr.ValueSchema, pr.ValueSchemaID),
+		Offsets:       make([]K.ProducerOffsets, len(pr.Records)),
+	}
+	f := faultFrom(r)
+	for i, rec := range pr.Records {
+		p := partition
+		switch {
+		case p >= 0:
+		case rec.Partition != nil:
+			p = *rec.Partition
+		default:
+			p = t.choose(rec.Key)
+		}
+		if f != nil {
+			if code, message, ok := f.recordError(i); ok {
+				res.Offsets[i] = K.ProducerOffsets{Partition: p, Offset: -1, ErrorCode: code, Error: message}
+				continue
+			}
+		}
+		res.Offsets[i] = s.append(t.partitions[p], record{key: rec.Key, value: rec.Value, headers: rec.Headers})
+	}
+
+	return http.StatusOK, res, nil
+}
+
+// schemaID registers the Avro schema if any, returning its id, or id otherwise.
+func (s *Server) schemaID(schema string, id int) int {
+	if schema == "" {
+		return id
+	}
+	if id, ok := s.schemas[schema]; ok {
+		return id
+	}
+	s.schemas[schema] = len(s.schemas) + 1
+	return s.schemas[schema]
+}
+
+func (s *Server) partitionMessages(r *http.Request) (int, interface{}, error) {
+	t, p, err := s.existingPartition(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	q := r.URL.Query()
+	offset, err := strconv.ParseInt(q.Get("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return 0, nil, apiError(http.StatusBadRequest, http.StatusBadRequest, "Invalid offset.")
+	}
+	count := 1
+	if q.Has("count") {
+		count, err = strconv.Atoi(q.Get("count"))
+		if err != nil || count < 1 {
+			return 0, nil, apiError(http.StatusBadRequest, http.StatusBadRequest, "Invalid count.")
+		}
+	}
+
+	return http.StatusOK, p.messages(t.name, offset, count), nil
+}
+
+func (s *Server) partitionOffsets(r *http.Request) (int, interface{}, error) {
+	_, p, err := s.existingPartition(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, K.PartitionOffsets{Partition: p.id, EndOffset: int64(len(p.log))}, nil
+}
+
+func (s *Server) newConsumer(r *http.Request) (int, interface{}, error) {
+	var cr K.ConsumerRequest
+	if err := decode(r, &cr); err != nil {
+		return 0, nil, err
+	}
+
+	switch cr.Format {
+	case "", K.Binary, K.JSON, K.Avro:
+	default:
+		return 0, nil, apiError(http.StatusUnprocessableEntity, errCodeInvalidConsumerConfig, "Invalid consumer configuration: unknown format.")
+	}
+	switch cr.Offset {
+	case "", K.Earliest, K.Latest, K.Smallest, K.Largest:
+	default:
+		return 0, nil, apiError(http.StatusUnprocessableEntity, errCodeInvalidConsumerConfig, "Invalid consumer configuration: unknown auto.offset.reset.")
+	}
+
+	name := r.PathValue("group")
+	g, ok := s.groups[name]
+	if !ok {
+		g = newGroup(name)
+		s.groups[name] = g
+	}
+	g.expire(s.InstanceTimeout, time.Now())
+
+	id := cr.Name
+	if id == "" {
+		s.sequence++
+		id = fmt.Sprintf("rest-consumer-%d", s.sequence)
+	}
+	if _, ok := g.instances[id]; ok {
+		return 0, nil, apiError(http.StatusConflict, errCodeConsumerInstanceExists, "Consumer with specified consumer ID already exists in the specified consumer group.")
+	}
+
+	g.instances[id] = &instance{name: id, request: cr, lastUsed: time.Now()}
+
+	return http.StatusOK, K.ConsumerInstance{
+		ConsumerName: id,
+		BaseURI:      s.URL + "/consumers/" + name + "/instances/" + id,
+	}, nil
+}
+
+// expireInstance deletes the consumer instance of the request.
+func (s *Server) expireInstance(r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if g, ok := s.groups[r.PathValue("group")]; ok {
+		delete(g.instances, r.PathValue("instance"))
+		g.rebalance(s)
+	}
+}
+
+// instance returns the consumer instance of the request, which is kept alive.
+func (s *Server) instance(r *http.Request) (*group, *instance, error) {
+	now := time.Now()
+	if g, ok := s.groups[r.PathValue("group")]; ok {
+		g.expire(s.InstanceTimeout, now)
+		if i, ok := g.instances[r.PathValue("instance")]; ok {
+			i.lastUsed = now
+			return g, i, nil
+		}
+	}
+	return nil, nil, apiError(http.StatusNotFound, K.ErrCodeConsumerInstanceNotFound, "Consumer instance not found.")
+}
+
+func (s *Server) deleteConsumer(r *http.Request) (int, interface{}, error) {
+	g, i, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	delete(g.instances, i.name)
+	g.rebalance(s)
+	return http.StatusNoContent, nil, nil
+}
+
+func (s *Server) commitOffsets(r *http.Request) (int, interface{}, error) {
+	g, i, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var co K.ConsumerOffsets
+	if err := decode(r, &co); err != nil {
+		return 0, nil, err
+	}
+
+	// without offsets, the positions of all partitions of the instance are committed
+	if len(co.Offsets) == 0 {
+		g.rebalance(s)
+		for _, tp := range i.assignment() {
+			co.Offsets = append(co.Offsets, K.ConsumerOffset{Topic: tp.Topic, Partition: tp.Partition, Offset: i.positions[tp]})
+		}
+	}
+	for _, o := range co.Offsets {
+		g.committed[K.ConsumerPartitions{Topic: o.Topic, Partition: o.Partition}] = o
+	}
+
+	return http.StatusOK, nil, nil
+}
+
+func (s *Server) committedOffsets(r *http.Request) (int, interface{}, error) {
+	g, _, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var cop K.ConsumerOffsetsPartitions
+	if err := decode(r, &cop); err != nil {
+		return 0, nil, err
+	}
+
+	co := K.ConsumerOffsets{Offsets: []K.ConsumerOffset{}}
+	for _, tp := range cop.Partitions {
+		if o, ok := g.committed[tp]; ok {
+			co.Offsets = append(co.Offsets, o)
+		}
+	}
+	return http.StatusOK, co, nil
+}
+
+func (s *Server) subscribe(r *http.Request) (int, interface{}, error) {
+	g, i, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var sr subscriptionRequest
+	if err := decode(r, &sr); err != nil {
+		return 0, nil, err
+	}
+
+	if len(i.assigned) > 0 {
+		return 0, nil, apiError(http.StatusConflict, errCodeIllegalState, "Illegal state: Subscription to topics, partitions and pattern are mutually exclusive.")
+	}
+
+	switch {
+	case sr.TopicPattern != "" && len(sr.Topics) > 0, sr.TopicPattern == "" && len(sr.Topics) == 0:
+		return 0, nil, apiError(http.StatusConflict, errCodeIllegalState, "Illegal state: Either topics or topic_pattern must be set.")
+	case sr.TopicPattern != "":
+		pattern, err := regexp.Compile("^(?:" + sr.TopicPattern + ")$")
+		if err != nil {
+			return 0, nil, apiError(http.StatusBadRequest, http.StatusBadRequest, err.Error())
+		}
+		i.topics, i.pattern = nil, pattern
+	default:
+		i.topics, i.pattern = sr.Topics, nil
+	}
+
+	g.rebalance(s)
+	return http.StatusNoContent, nil, nil
+}
+
+func (s *Server) subscriptions(r *http.Request) (int, interface{}, error) {
+	_, i, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	topics := []string{}
+	if i.pattern != nil {
+		for _, name := range s.topicNames() {
+			if i.subscribes(name) {
+				topics = append(topics, name)
+			}
+		}
+	} else {
+		topics = append(topics, i.topics...)
+	}
+	return http.StatusOK, K.TopicsSubscription{Topics: topics}, nil
+}
+
+func (s *Server) unsubscribe(r *http.Request) (int, interface{}, error) {
+	g, i, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	i.topics, i.pattern = nil, nil
+	g.rebalance(s)
+	return http.StatusNoContent, nil, nil
+}
+
+func (s *Server) assign(r *http.Request) (int, interface{}, error) {
+	g, i, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var cop K.ConsumerOffsetsPartitions
+	if err := decode(r, &cop); err != nil {
+		return 0, nil, err
+	}
+
+	if i.subscribed() {
+		return 0, nil, apiError(http.StatusConflict, errCodeIllegalState, "Illegal state: Subscription to topics, partitions and pattern are mutually exclusive.")
+	}
+
+	i.assigned = cop.Partitions
+	g.rebalance(s)
+	return http.StatusNoContent, nil, nil
+}
+
+func (s *Server) assignments(r *http.Request) (int, interface{}, error) {
+	g, i, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	g.rebalance(s)
+	return http.StatusOK, K.ConsumerOffsetsPartitions{Partitions: i.assignment()}, nil
+}
+
+func (s *Server) seek(r *http.Request) (int, interface{}, error) {
+	var co K.ConsumerOffsets
+	if err := decode(r, &co); err != nil {
+		return 0, nil, err
+	}
+
+	partitions := make([]K.ConsumerPartitions, len(co.Offsets))
+	for j, o := range co.Offsets {
+		partitions[j] = K.ConsumerPartitions{Topic: o.Topic, Partition: o.Partition}
+	}
+
+	return s.reposition(r, partitions, func(j int, p *partition) int64 {
+		return co.Offsets[j].Offset
+	})
+}
+
+func (s *Server) seekToBeginning(r *http.Request) (int, interface{}, error) {
+	var cop K.ConsumerOffsetsPartitions
+	if err := decode(r, &cop); err != nil {
+		return 0, nil, err
+	}
+
+	return s.reposition(r, cop.Partitions, func(int, *partition) int64 {
+		return 0
+	})
+}
+
+func (s *Server) seekToEnd(r *http.Request) (int, interface{}, error) {
+	var cop K.ConsumerOffsetsPartitions
+	if err := decode(r, &cop); err != nil {
+		return 0, nil, err
+	}
+
+	return s.reposition(r, cop.Partitions, func(_ int, p *partition) int64 {
+		return int64(len(p.log))
+	})
+}
+
+// reposition moves the positions of partitions of the instance to offset, all partitions must be assigned.
+func (s *Server) reposition(r *http.Request, partitions []K.ConsumerPartitions, offset func(int, *partition) int64) (int, interface{}, error) {
+	g, i, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	g.rebalance(s)
+	for _, tp := range partitions {
+		if _, ok := i.positions[tp]; !ok {
+			return 0, nil, apiError(http.StatusConflict, errCodeIllegalState,
+				fmt.Sprintf("Illegal state: No current assignment for partition %v-%v", tp.Topic, tp.Partition))
+		}
+	}
+	for j, tp := range partitions {
+		i.positions[tp] = offset(j, s.topics[tp.Topic].partitions[tp.Partition])
+	}
+
+	return http.StatusNoContent, nil, nil
+}
+
+// records fetches from all partitions of the instance via API v2,
+// waiting up to the timeout query parameter in milliseconds for records if there are none.
+func (s *Server) records(r *http.Request) (int, interface{}, error) {
+	q := r.URL.Query()
+
+	var timeout time.Duration
+	if q.Has("timeout") {
+		ms, err := strconv.Atoi(q.Get("timeout"))
+		if err != nil || ms < 0 {
+			return 0, nil, apiError(http.StatusBadRequest, http.StatusBadRequest, "Invalid timeout.")
+		}
+		timeout = time.Duration(ms) * time.Millisecond
+	}
+
+	return s.fetch(r, "", timeout)
+}
+
+// messages fetches from the topic via API v1, subscribing the instance to it on first fetch.
+func (s *Server) messages(r *http.Request) (int, interface{}, error) {
+	_, i, err := s.instance(r)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	topicName := r.PathValue("topic")
+	if _, ok := s.topics[topicName]; !ok {
+		return 0, nil, apiError(http.StatusNotFound, K.ErrCodeTopicNotFound, "Topic not found.")
+	}
+	if len(i.assigned) == 0 && !i.subscribes(topicName) {
+		i.topics = append(i.topics, topicName)
+	}
+
+	return s.fetch(r, topicName, 0)
+}
+
+// fetch returns the records from the positions of the partitions of the instance, of topicName only if set,
+// up to the max_bytes query parameter of keys and values, at least one record.
+// Positions move past the fetched records, which are committed if auto.commit.enable of the instance is true.
+func (s *Server) fetch(r *http.Request, topicName string, timeout time.Duration) (int, interface{}, error) {
+	q := r.URL.Query()
+
+	maxBytes := 0
+	if q.Has("max_bytes") {
+		var err error
+		maxBytes, err = strconv.Atoi(q.Get("max_bytes"))
+		if err != nil || maxBytes < 0 {
+			return 0, nil, apiError(http.StatusBadRequest, http.StatusBadRequest, "Invalid max_bytes.")
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		g, i, err := s.instance(r)
+		if err != nil {
+			return 0, nil, err
+		}
+		g.rebalance(s)
+
+		m := []K.Message{}
+		size := 0
+	partitions:
+		for _, tp := range i.assignment() {
+			if topicName != "" && tp.Topic != topicName {
+				continue
+			}
+
+			p := s.topics[tp.Topic].partitions[tp.Partition]
+			for o := i.positions[tp]; o < int64(len(p.log)); o++ {
+				size += len(p.log[o].key) + len(p.log[o].value)
+				if maxBytes > 0 && size > maxBytes && len(m) > 0 {
+					break partitions
+				}
+				m = append(m, p.message(tp.Topic, o))
+				i.positions[tp] = o + 1
+			}
+		}
+
+		if i.request.AutoCommit == "true" {
+			for tp, offset := range i.positions {
+				g.committed[tp] = K.ConsumerOffset{Topic: tp.Topic, Partition: tp.Partition, Offset: offset}
+			}
+		}
+
+		wait := time.Until(deadline)
+		if len(m) > 0 || wait <= 0 || r.Context().Err() != nil {
+			return http.StatusOK, m, nil
+		}
+
+		// wait for records to be produced with the Server unlocked
+		changed := s.changed
+		s.mu.Unlock()
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+		case <-timer.C:
+		case <-r.Context().Done():
+		}
+		timer.Stop()
+		s.mu.Lock()
+	}
+}
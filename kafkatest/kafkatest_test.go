@@ -0,0 +1,255 @@
+package kafkatest_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/andy2046/kafka-rest-go/kafkatest"
+)
+
+func TestServerProduceConsume(t *testing.T) {
+	s, err := kafkatest.NewServer(kafkatest.SetBrokers(1, 2, 3))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	defer s.Close()
+
+	if err := s.CreateTopic("t", 2); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	k, _ := s.Client(K.V2Version)
+	message := &K.ProducerMessage{}
+	for i := 0; i < 10; i++ {
+		message.Records = append(message.Records, K.ProducerRecord{
+			Key:   json.RawMessage(fmt.Sprintf(`"k%d"`, i)),
+			Value: json.RawMessage(fmt.Sprintf(`"v%d"`, i)),
+		})
+	}
+	pr, err := k.NewTopics().Produce("t", message)
+	if err != nil || len(pr.Offsets) != 10 {
+		t.Fatalf("Expected 10 offsets got %v %v", pr, err)
+	}
+
+	mc := k.NewConsumers("cg").NewManagedConsumer(K.ConsumerRequest{Format: K.Binary, Offset: K.Earliest})
+	mc.Topics = []string{"t"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	consumed := 0
+	err = mc.Run(ctx, func(_ context.Context, messages []K.Message) error {
+		consumed += len(messages)
+		if consumed >= 10 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled || consumed != 10 {
+		t.Fatalf("Expected 10 messages got %d %v", consumed, err)
+	}
+
+	committed := int64(0)
+	for p := 0; p < 2; p++ {
+		offset, _ := s.CommittedOffset("cg", "t", p)
+		committed += offset
+	}
+	if committed != 10 {
+		t.Errorf("Expected committed offsets to add up to 10 got %d", committed)
+	}
+
+	po, err := k.NewTopics().NewPartitions().Offsets(context.Background(), 0, "t")
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	messages, _ := s.Messages("t", 0)
+	if po.EndOffset != int64(len(messages)) {
+		t.Errorf("Expected end offset %d got %d", len(messages), po.EndOffset)
+	}
+}
+
+func TestServerRebalance(t *testing.T) {
+	s, _ := kafkatest.NewServer()
+	defer s.Close()
+	s.CreateTopic("t", 4)
+
+	k, _ := s.Client(K.V2Version)
+	cs := k.NewConsumers("cg")
+	subscription := &K.TopicSubscription{Topics: &K.TopicsSubscription{Topics: []string{"t"}}}
+
+	var names []string
+	for i := 0; i < 2; i++ {
+		ci, err := cs.NewConsumer(&K.ConsumerRequest{Format: K.Binary, Offset: K.Earliest})
+		if err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		if err := cs.Subscribe(subscription, false, ci.ConsumerName); err != nil {
+			t.Fatalf("Expected no error got %v", err)
+		}
+		names = append(names, ci.ConsumerName)
+	}
+
+	for _, name := range names {
+		a, err := cs.Assignments(name)
+		if err != nil || len(a.Partitions) != 2 {
+			t.Errorf("Expected 2 partitions for %v got %v %v", name, a, err)
+		}
+	}
+
+	if err := cs.DeleteConsumer(names[0]); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if a, _ := cs.Assignments(names[1]); len(a.Partitions) != 4 {
+		t.Errorf("Expected 4 partitions after rebalance got %v", a)
+	}
+
+	_, err := cs.Assignments(names[0])
+	if !K.IsConsumerInstanceNotFound(err) {
+		t.Errorf("Expected consumer instance not found got %v", err)
+	}
+}
+
+func TestServerFaults(t *testing.T) {
+	s, _ := kafkatest.NewServer()
+	defer s.Close()
+	s.CreateTopic("t", 1)
+
+	unavailable := &kafkatest.Fault{Endpoint: "POST /topics/{topic}", Times: 1, StatusCode: 500, ErrorCode: K.ErrCodeRetriableKafka}
+	partial := &kafkatest.Fault{Endpoint: "POST /topics/{topic}", Times: 1, FailRecords: []int{1}}
+	drop := &kafkatest.Fault{Endpoint: "/topics/{topic}", After: 1, Times: 1, Drop: true}
+	s.Inject(unavailable, partial, drop)
+
+	k, _ := s.Client(K.V2Version)
+	ts := k.NewTopics()
+	message := &K.ProducerMessage{Records: []K.ProducerRecord{{Value: json.RawMessage(`"a"`)}, {Value: json.RawMessage(`"b"`)}}}
+
+	_, err := ts.Produce("t", message)
+	if apiErr, ok := err.(*K.APIError); !ok || apiErr.ErrorCode != K.ErrCodeRetriableKafka {
+		t.Fatalf("Expected error code %d got %v", K.ErrCodeRetriableKafka, err)
+	}
+
+	pr, err := ts.Produce("t", message)
+	if err == nil || pr.Offsets[0].ErrorCode != 0 || pr.Offsets[1].ErrorCode != K.ProducerErrCodeRetriable {
+		t.Fatalf("Expected the second record to fail got %+v %v", pr, err)
+	}
+
+	// the first request after the partial failure is not dropped, the second one is but still appends
+	if _, err := ts.Topic("t"); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if _, err := ts.Produce("t", message); err == nil {
+		t.Fatal("Expected dropped connection error")
+	}
+
+	if _, err := ts.Produce("t", message); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	messages, _ := s.Messages("t", 0)
+	if len(messages) != 5 || unavailable.Applied() != 1 || partial.Applied() != 1 || drop.Applied() != 1 {
+		t.Errorf("Expected 5 messages and faults applied once got %d %d %d %d",
+			len(messages), unavailable.Applied(), partial.Applied(), drop.Applied())
+	}
+}
+
+func TestRecordReplay(t *testing.T) {
+	s, _ := kafkatest.NewServer()
+	s.CreateTopic("t", 1)
+
+	recorder := kafkatest.NewRecorder(nil)
+	k, _ := K.New(K.SetURL(strings.Replace(s.URL, "http://", "http://user:secret@", 1)), K.V2Version, K.SetTransport(recorder))
+	run := func(k *K.Kafka) ([]string, error) {
+		cs := k.NewConsumers("cg")
+		ci, err := cs.NewConsumer(&K.ConsumerRequest{Format: K.Binary, Offset: K.Earliest, Name: fmt.Sprint(time.Now().UnixNano())})
+		if err != nil {
+			return nil, err
+		}
+		defer cs.DeleteConsumer(ci.ConsumerName)
+		return k.NewTopics().Names()
+	}
+
+	recorded, err := run(k)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	s.Close()
+
+	golden := filepath.Join(t.TempDir(), "golden.json")
+	if err := recorder.Save(golden); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if b, _ := os.ReadFile(golden); strings.Contains(string(b), base64.StdEncoding.EncodeToString([]byte("user:secret"))) {
+		t.Error("Expected credentials redacted")
+	}
+
+	// the consumer name differs between runs
+	replayer, err := kafkatest.LoadReplayer(golden, kafkatest.IgnoreJSONField("name"))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	k, _ = K.New(K.SetURL("http://replay.invalid"), K.V2Version, K.SetTransport(replayer))
+	replayed, err := run(k)
+	if err != nil || len(replayed) != 1 || replayed[0] != recorded[0] {
+		t.Fatalf("Expected %v got %v %v", recorded, replayed, err)
+	}
+	if unused := replayer.Unused(); len(unused) != 0 {
+		t.Errorf("Expected all interactions replayed got %v", unused)
+	}
+}
+
+// roundTripper is a http.RoundTripper calling the func.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRecorderRoundTrip(t *testing.T) {
+	var sent *http.Request
+	var sentBody []byte
+	recorder := kafkatest.NewRecorder(roundTripper(func(req *http.Request) (*http.Response, error) {
+		sent = req
+		sentBody, _ = io.ReadAll(req.Body)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Set-Cookie": {"session=secret"}},
+			Body:       io.NopCloser(strings.NewReader(`{}`)),
+		}, nil
+	}))
+
+	body := io.NopCloser(strings.NewReader(`{"records":[]}`))
+	req, _ := http.NewRequest("POST", "http://proxy/topics/t", body)
+	req.Header.Set("Authorization", "Basic secret")
+
+	res, err := recorder.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+
+	// the request of the caller is not modified, a clone with the body is sent
+	if req.Body != body || req.Header.Get("Authorization") != "Basic secret" {
+		t.Errorf("Expected request unmodified got %v %v", req.Body, req.Header)
+	}
+	if sent == req || string(sentBody) != `{"records":[]}` {
+		t.Errorf("Expected clone with body sent got %v %q", sent == req, sentBody)
+	}
+	if b, _ := io.ReadAll(res.Body); string(b) != `{}` || res.Request != req || res.Header.Get("Set-Cookie") != "session=secret" {
+		t.Errorf("Expected response unmodified got %q %v", b, res.Header)
+	}
+
+	// headers are redacted when recorded
+	in := recorder.Interactions()
+	if len(in) != 1 || in[0].Request.Header.Get("Authorization") != "REDACTED" ||
+		in[0].Response.Header.Get("Set-Cookie") != "REDACTED" || in[0].Request.Body != `{"records":[]}` {
+		t.Errorf("Expected redacted interaction got %+v", in)
+	}
+}
@@ -0,0 +1,255 @@
+package kafkatest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// Interaction is a recorded request with its response.
+	Interaction struct {
+		Request  RecordedRequest  `json:"request"`
+		Response RecordedResponse `json:"response"`
+	}
+
+	// RecordedRequest is a request without scheme and host, so that it replays against any URL.
+	RecordedRequest struct {
+		Method string      `json:"method"`
+		Path   string      `json:"path"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body,omitempty"`
+	}
+
+	// RecordedResponse is the response to a RecordedRequest.
+	RecordedResponse struct {
+		StatusCode int         `json:"status_code"`
+		Header     http.Header `json:"header,omitempty"`
+		Body       string      `json:"body,omitempty"`
+	}
+
+	// Recorder is a http.RoundTripper recording the interactions made via Transport, e.g. with a real REST proxy,
+	// to be saved as a golden file and served by a Replayer.
+	Recorder struct {
+		// Transport makes the requests, http.DefaultTransport if nil
+		Transport http.RoundTripper
+		// Redact are the headers whose values are replaced when recorded, default to RedactedHeaders
+		Redact []string
+
+		mu           sync.Mutex
+		interactions []Interaction
+	}
+
+	// Replayer is a http.RoundTripper serving recorded interactions, each once, in the recorded order.
+	// A request is served the first unused interaction with the same method, path and body,
+	// compared after the Ignore patterns are masked in both.
+	Replayer struct {
+		// Ignore are patterns of non-deterministic parts of paths and bodies, e.g. generated names
+		Ignore []*regexp.Regexp
+
+		mu           sync.Mutex
+		interactions []Interaction
+		used         []bool
+	}
+
+	goldenFile struct {
+		Interactions []Interaction `json:"interactions"`
+	}
+)
+
+// redacted replaces the values of redacted headers.
+const redacted = "REDACTED"
+
+// RedactedHeaders are the credential headers a Recorder redacts by default.
+var RedactedHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// NewRecorder returns a Recorder making requests via transport, http.DefaultTransport if nil.
+func NewRecorder(transport http.RoundTripper) *Recorder {
+	return &Recorder{Transport: transport}
+}
+
+// RoundTrip implements http.RoundTripper.
+// The request is left unmodified, its body is read and a clone with a copy of it is sent via Transport.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	reqBody, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	out := req
+	if req.Body != nil && req.Body != http.NoBody {
+		out = req.Clone(req.Context())
+		out.Body = io.NopCloser(bytes.NewReader(reqBody))
+		out.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(reqBody)), nil
+		}
+	}
+
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	res, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	resBody, err := readBody(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	res.Request = req
+
+	names := r.Redact
+	if names == nil {
+		names = RedactedHeaders
+	}
+	in := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			Path:   req.URL.RequestURI(),
+			Header: req.Header.Clone(),
+			Body:   string(reqBody),
+		},
+		Response: RecordedResponse{
+			StatusCode: res.StatusCode,
+			Header:     res.Header.Clone(),
+			Body:       string(resBody),
+		},
+	}
+	redact(in.Request.Header, names)
+	redact(in.Response.Header, names)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interactions = append(r.interactions, in)
+
+	return res, nil
+}
+
+// Interactions returns the interactions recorded so far, with redacted headers.
+func (r *Recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// Save writes the recorded interactions with redacted headers to the golden file at path.
+func (r *Recorder) Save(path string) error {
+	b, err := json.MarshalIndent(goldenFile{Interactions: r.Interactions()}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// LoadReplayer returns a Replayer of the golden file at path, ignore are its Ignore patterns.
+func LoadReplayer(path string, ignore ...*regexp.Regexp) (*Replayer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var golden goldenFile
+	if err := json.Unmarshal(b, &golden); err != nil {
+		return nil, errors.Wrap(err, "Error: parse golden file "+path)
+	}
+
+	return &Replayer{
+		Ignore:       ignore,
+		interactions: golden.Interactions,
+		used:         make([]bool, len(golden.Interactions)),
+	}, nil
+}
+
+// IgnoreJSONField returns a pattern matching the string or number value of the JSON field name,
+// for Replayer.Ignore.
+func IgnoreJSONField(name string) *regexp.Regexp {
+	return regexp.MustCompile(`"` + regexp.QuoteMeta(name) + `"\s*:\s*("(?:[^"\\]|\\.)*"|-?[0-9.eE+-]+)`)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	b, err := readBody(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	path, body := r.mask(req.URL.RequestURI()), r.mask(string(b))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, in := range r.interactions {
+		if r.used[i] || in.Request.Method != req.Method || r.mask(in.Request.Path) != path || r.mask(in.Request.Body) != body {
+			continue
+		}
+
+		r.used[i] = true
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.StatusCode, http.StatusText(in.Response.StatusCode)),
+			StatusCode:    in.Response.StatusCode,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        in.Response.Header.Clone(),
+			Body:          io.NopCloser(bytes.NewBufferString(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, errors.Errorf("Error: no recorded interaction for %v %v", req.Method, req.URL.RequestURI())
+}
+
+// Unused returns the recorded interactions which have not been replayed.
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var unused []Interaction
+	for i, in := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, in)
+		}
+	}
+	return unused
+}
+
+func (r *Replayer) mask(s string) string {
+	for _, re := range r.Ignore {
+		s = re.ReplaceAllString(s, "*")
+	}
+	return s
+}
+
+// readBody reads and closes the body, if any.
+func readBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil || body == http.NoBody {
+		return nil, nil
+	}
+
+	b, err := io.ReadAll(body)
+	body.Close()
+	return b, err
+}
+
+func redact(header http.Header, names []string) {
+	for _, name := range names {
+		if _, ok := header[http.CanonicalHeaderKey(name)]; ok {
+			header.Set(name, redacted)
+		}
+	}
+}
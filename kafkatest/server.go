@@ -0,0 +1,307 @@
+// Package kafkatest provides an in-memory Kafka REST proxy for tests.
+//
+// Server implements the v1 and v2 REST API surface used by package kafka: brokers, topics, partitions,
+// produce, consumer instances, subscriptions, assignments, positions, offsets, records and messages.
+// Partitions are append-only logs with real offsets, consumer groups keep committed offsets and
+// rebalance partitions between subscribed instances, so consumers and producers can be tested without Kafka.
+//
+// Keys, values and record headers are stored and returned as sent, embedded formats are not converted.
+// Failures such as latency, error responses, consumer expiry and dropped connections are injected with Fault.
+package kafkatest
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math/rand"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Server is an in-memory Kafka REST proxy listening on a local address.
+	Server struct {
+		// URL of the proxy, e.g. http://127.0.0.1:51234
+		URL string
+		// Brokers are the broker ids, default to 1
+		Brokers []int
+		// AutoCreatePartitions is the number of partitions of topics created on first produce,
+		// producing to a topic which does not exist fails if 0
+		AutoCreatePartitions int
+		// InstanceTimeout is how long consumer instances live without requests, forever if 0
+		InstanceTimeout time.Duration
+
+		server   *httptest.Server
+		mu       sync.Mutex
+		topics   map[string]*topic
+		groups   map[string]*group
+		schemas  map[string]int
+		sequence int
+		faults   []*Fault
+		rand     *rand.Rand
+		// changed is closed and replaced whenever records are produced
+		changed chan struct{}
+	}
+
+	topic struct {
+		name       string
+		partitions []*partition
+		next       int
+	}
+
+	partition struct {
+		id       int
+		replicas []int
+		log      []record
+	}
+
+	record struct {
+		key     json.RawMessage
+		value   json.RawMessage
+		headers []K.Header
+	}
+)
+
+// replicationFactor is the maximum number of replicas of a partition.
+const replicationFactor = 3
+
+// NewServer starts a Server, which must be closed with Close.
+func NewServer(options ...func(*Server) error) (*Server, error) {
+	s := &Server{
+		Brokers: []int{1},
+		topics:  map[string]*topic{},
+		groups:  map[string]*group{},
+		schemas: map[string]int{},
+		changed: make(chan struct{}),
+		rand:    rand.New(rand.NewSource(1)),
+	}
+
+	for _, opt := range options {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.Brokers) == 0 {
+		return nil, errors.New("Error: no brokers")
+	}
+
+	s.server = httptest.NewServer(s.handler())
+	s.URL = s.server.URL
+	return s, nil
+}
+
+// SetBrokers applies Brokers to Server.
+func SetBrokers(brokers ...int) func(*Server) error {
+	return func(s *Server) error {
+		s.Brokers = brokers
+		return nil
+	}
+}
+
+// AutoCreateTopics creates topics with partitions on first produce.
+func AutoCreateTopics(partitions int) func(*Server) error {
+	return func(s *Server) error {
+		if partitions < 0 {
+			return errors.New("Error: negative partitions")
+		}
+		s.AutoCreatePartitions = partitions
+		return nil
+	}
+}
+
+// SetInstanceTimeout applies InstanceTimeout to Server.
+func SetInstanceTimeout(timeout time.Duration) func(*Server) error {
+	return func(s *Server) error {
+		s.InstanceTimeout = timeout
+		return nil
+	}
+}
+
+// Close shuts down the Server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Client returns a Kafka instance for the Server, options are applied after its URL.
+func (s *Server) Client(options ...func(*K.Kafka) error) (*K.Kafka, error) {
+	return K.New(append([]func(*K.Kafka) error{K.SetURL(s.URL)}, options...)...)
+}
+
+// CreateTopic creates a topic with partitions, each led by a broker in turn.
+func (s *Server) CreateTopic(topicName string, partitions int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.topics[topicName]; ok {
+		return errors.Errorf("Error: topic %v already exists", topicName)
+	}
+	if partitions < 1 {
+		return errors.New("Error: topic requires partitions")
+	}
+
+	s.createTopic(topicName, partitions)
+	return nil
+}
+
+// DeleteTopic deletes a topic with its records, consumers lose the partitions on their next request.
+func (s *Server) DeleteTopic(topicName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.topics[topicName]; !ok {
+		return errors.Errorf("Error: topic %v not found", topicName)
+	}
+	delete(s.topics, topicName)
+	return nil
+}
+
+// Produce appends records to the partition of the topic, or to partitions chosen by key if partition is negative,
+// the way producing via the REST API does. Record Partition fields are ignored.
+func (s *Server) Produce(topicName string, partition int, records ...K.ProducerRecord) ([]K.ProducerOffsets, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, err := s.topic(topicName)
+	if err != nil {
+		return nil, err
+	}
+	if partition >= len(t.partitions) {
+		return nil, apiError(404, K.ErrCodePartitionNotFound, "Partition not found.")
+	}
+
+	offsets := make([]K.ProducerOffsets, len(records))
+	for i, r := range records {
+		p := partition
+		if p < 0 {
+			p = t.choose(r.Key)
+		}
+		offsets[i] = s.append(t.partitions[p], record{key: r.Key, value: r.Value, headers: r.Headers})
+	}
+	return offsets, nil
+}
+
+// Messages returns the records of the partition of the topic.
+func (s *Server) Messages(topicName string, partition int) ([]K.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.topics[topicName]
+	if !ok {
+		return nil, errors.Errorf("Error: topic %v not found", topicName)
+	}
+	if partition < 0 || partition >= len(t.partitions) {
+		return nil, errors.Errorf("Error: partition %v not found for topic %v", partition, topicName)
+	}
+
+	p := t.partitions[partition]
+	return p.messages(topicName, 0, len(p.log)), nil
+}
+
+// CommittedOffset returns the offset committed by the consumer group for the partition of the topic.
+func (s *Server) CommittedOffset(consumerGroup, topicName string, partition int) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g, ok := s.groups[consumerGroup]
+	if !ok {
+		return 0, false
+	}
+	co, ok := g.committed[K.ConsumerPartitions{Topic: topicName, Partition: partition}]
+	return co.Offset, ok
+}
+
+// topic returns the topic, created if AutoCreatePartitions is set.
+func (s *Server) topic(topicName string) (*topic, error) {
+	if t, ok := s.topics[topicName]; ok {
+		return t, nil
+	}
+	if s.AutoCreatePartitions == 0 {
+		return nil, apiError(404, K.ErrCodeTopicNotFound, "Topic not found.")
+	}
+	return s.createTopic(topicName, s.AutoCreatePartitions), nil
+}
+
+func (s *Server) createTopic(topicName string, partitions int) *topic {
+	t := &topic{name: topicName, partitions: make([]*partition, partitions)}
+
+	n := len(s.Brokers)
+	if n > replicationFactor {
+		n = replicationFactor
+	}
+	for i := range t.partitions {
+		p := &partition{id: i, replicas: make([]int, n)}
+		for j := range p.replicas {
+			p.replicas[j] = s.Brokers[(i+j)%len(s.Brokers)]
+		}
+		t.partitions[i] = p
+	}
+
+	s.topics[topicName] = t
+	return t
+}
+
+func (s *Server) append(p *partition, r record) K.ProducerOffsets {
+	p.log = append(p.log, r)
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+
+	return K.ProducerOffsets{Partition: p.id, Offset: int64(len(p.log) - 1)}
+}
+
+// topicNames returns the names of all topics in order.
+func (s *Server) topicNames() []string {
+	names := make([]string, 0, len(s.topics))
+	for name := range s.topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// choose returns the partition of a record by the hash of its key, round robin without key.
+func (t *topic) choose(key json.RawMessage) int {
+	if len(key) == 0 || string(key) == "null" {
+		p := t.next % len(t.partitions)
+		t.next++
+		return p
+	}
+
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(t.partitions)))
+}
+
+func (t *topic) metadata() K.Topic {
+	kt := K.Topic{Name: t.name, Configs: json.RawMessage("{}"), Partitions: make([]K.Partition, len(t.partitions))}
+	for i, p := range t.partitions {
+		kt.Partitions[i] = p.metadata()
+	}
+	return kt
+}
+
+func (p *partition) metadata() K.Partition {
+	kp := K.Partition{Partition: p.id, Leader: p.replicas[0], Replicas: make([]K.Replica, len(p.replicas))}
+	for i, broker := range p.replicas {
+		kp.Replicas[i] = K.Replica{Broker: broker, Leader: i == 0, InSync: true}
+	}
+	return kp
+}
+
+// messages returns up to count records from offset.
+func (p *partition) messages(topicName string, offset int64, count int) []K.Message {
+	m := []K.Message{}
+	for o := offset; o < int64(len(p.log)) && len(m) < count; o++ {
+		m = append(m, p.message(topicName, o))
+	}
+	return m
+}
+
+func (p *partition) message(topicName string, offset int64) K.Message {
+	r := p.log[offset]
+	return K.Message{Topic: topicName, Key: r.key, Value: r.value, Partition: p.id, Offset: offset, Headers: r.headers}
+}
@@ -0,0 +1,373 @@
+// Package otelkafka instruments package kafka with OpenTelemetry tracing.
+//
+// Tracer.Instrument makes a client span of every REST API request, named after its endpoint template
+// and carrying its method, topic, partition, consumer group and status code.
+// Tracer.Produce makes a producer span and injects its W3C trace context into the record headers,
+// Tracer.HandleMessage and Tracer.HandleMessages make consumer spans linked to the producer spans
+// whose trace context they extract from the headers of fetched messages.
+//
+// Record headers are carried by REST proxies which support them only, e.g. kafkatest.Server.
+package otelkafka
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type (
+	// Tracer makes the spans of package kafka calls.
+	Tracer struct {
+		provider   trace.TracerProvider
+		propagator propagation.TextMapPropagator
+		tracer     trace.Tracer
+	}
+
+	transport struct {
+		tracer *Tracer
+		base   http.RoundTripper
+	}
+
+	// spanBody ends the span of a request when its response body is closed.
+	spanBody struct {
+		io.ReadCloser
+		span trace.Span
+		once sync.Once
+	}
+
+	// headerCarrier adapts record headers to propagation.TextMapCarrier.
+	headerCarrier struct {
+		headers *[]K.Header
+	}
+)
+
+// instrumentationName is the name of the tracer of this package.
+const instrumentationName = "github.com/andy2046/kafka-rest-go/otelkafka"
+
+// Semantic convention attribute keys and values.
+const (
+	messagingSystem        = attribute.Key("messaging.system")
+	messagingOperationType = attribute.Key("messaging.operation.type")
+	messagingDestination   = attribute.Key("messaging.destination.name")
+	messagingPartition     = attribute.Key("messaging.destination.partition.id")
+	messagingConsumerGroup = attribute.Key("messaging.consumer.group.name")
+	messagingClientID      = attribute.Key("messaging.client.id")
+	messagingBatchCount    = attribute.Key("messaging.batch.message_count")
+	messagingKafkaOffset   = attribute.Key("messaging.kafka.offset")
+	httpRequestMethod      = attribute.Key("http.request.method")
+	httpResponseStatusCode = attribute.Key("http.response.status_code")
+	urlTemplate            = attribute.Key("url.template")
+	serverAddress          = attribute.Key("server.address")
+
+	systemKafka      = "kafka"
+	operationPublish = "publish"
+	operationProcess = "process"
+)
+
+// New returns a Tracer using the global TracerProvider and the W3C trace context propagator by default.
+func New(options ...func(*Tracer) error) (*Tracer, error) {
+	t := &Tracer{
+		provider:   otel.GetTracerProvider(),
+		propagator: propagation.TraceContext{},
+	}
+	for _, opt := range options {
+		if err := opt(t); err != nil {
+			return nil, err
+		}
+	}
+
+	t.tracer = t.provider.Tracer(instrumentationName)
+	return t, nil
+}
+
+// SetTracerProvider applies the TracerProvider to Tracer.
+func SetTracerProvider(provider trace.TracerProvider) func(*Tracer) error {
+	return func(t *Tracer) error {
+		t.provider = provider
+		return nil
+	}
+}
+
+// SetPropagator applies the propagator of trace context to Tracer, for both requests and record headers.
+func SetPropagator(propagator propagation.TextMapPropagator) func(*Tracer) error {
+	return func(t *Tracer) error {
+		t.propagator = propagator
+		return nil
+	}
+}
+
+// Instrument wraps the Transport of k so that every request makes a client span, it is a Kafka option,
+// e.g. kafka.New(kafka.SetTransport(base), tracer.Instrument), to be applied after the Transport is set.
+func (t *Tracer) Instrument(k *K.Kafka) error {
+	k.Transport = t.Transport(k.Transport)
+	return nil
+}
+
+// Transport returns a http.RoundTripper making a client span of every request made via base,
+// http.DefaultTransport if nil, and injecting its trace context into the request headers.
+func (t *Tracer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{tracer: t, base: base}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (rt *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	name := req.Method
+	attrs := []attribute.KeyValue{
+		httpRequestMethod.String(req.Method),
+		serverAddress.String(req.URL.Hostname()),
+	}
+	if e, ok := K.EndpointFrom(req.Context()); ok {
+		name = e.Name
+		attrs = append(attrs, urlTemplate.String(e.Name))
+		attrs = append(attrs, endpointAttributes(e)...)
+	}
+
+	ctx, span := rt.tracer.tracer.Start(req.Context(), name,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+
+	req = req.Clone(ctx)
+	rt.tracer.propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := rt.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(httpResponseStatusCode.Int(res.StatusCode))
+	if res.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+	}
+	if res.Body == nil || res.Body == http.NoBody {
+		span.End()
+		return res, nil
+	}
+
+	res.Body = &spanBody{ReadCloser: res.Body, span: span}
+	return res, nil
+}
+
+// Close implements io.Closer, ending the span.
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() { b.span.End() })
+	return err
+}
+
+// Produce produces message to the topic with a producer span, injecting its trace context into the records,
+// which are copied so that message is not modified.
+func (t *Tracer) Produce(ctx context.Context, ts *K.Topics, topicName string, message *K.ProducerMessage) (*K.ProducerResponse, error) {
+	ctx, span := t.startProducer(ctx, topicName, -1, message)
+	defer span.End()
+
+	pr, err := ts.ProduceContext(ctx, topicName, t.inject(ctx, message))
+	return pr, endProducer(span, pr, err)
+}
+
+// ProducePartition is like Produce but produces message to the partition of the topic.
+func (t *Tracer) ProducePartition(ctx context.Context, ps *K.Partitions, partition int, message *K.ProducerMessage, topicName ...string) (*K.ProducerResponse, error) {
+	name := ""
+	if len(topicName) > 0 {
+		name = topicName[0]
+	} else if ps.Topic != nil {
+		name = ps.Topic.Name
+	}
+
+	ctx, span := t.startProducer(ctx, name, partition, message)
+	defer span.End()
+
+	pr, err := ps.ProduceContext(ctx, partition, t.inject(ctx, message), topicName...)
+	return pr, endProducer(span, pr, err)
+}
+
+// Inject injects the trace context of ctx into the headers of record.
+func (t *Tracer) Inject(ctx context.Context, record *K.ProducerRecord) {
+	t.propagator.Inject(ctx, headerCarrier{&record.Headers})
+}
+
+// Extract returns ctx with the remote trace context extracted from the headers of message, if any.
+func (t *Tracer) Extract(ctx context.Context, message K.Message) context.Context {
+	return t.propagator.Extract(ctx, headerCarrier{&message.Headers})
+}
+
+// HandleMessage wraps handler, e.g. of a kafka.Dispatcher, so that each message is processed in a consumer span
+// linked to the producer span of the message.
+func (t *Tracer) HandleMessage(handler func(context.Context, K.Message) error) func(context.Context, K.Message) error {
+	return func(ctx context.Context, m K.Message) error {
+		attrs := append(messageAttributes(m.Topic), messagingPartition.String(strconv.Itoa(m.Partition)),
+			messagingKafkaOffset.Int64(m.Offset))
+		ctx, span := t.tracer.Start(ctx, operationProcess+" "+m.Topic,
+			trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attrs...),
+			trace.WithLinks(t.links(m)...))
+		defer span.End()
+
+		return endSpan(span, handler(ctx, m))
+	}
+}
+
+// HandleMessages wraps handler, e.g. of a kafka.ManagedConsumer, so that each batch is processed in a consumer span
+// linked to the producer spans of its messages.
+func (t *Tracer) HandleMessages(handler func(context.Context, []K.Message) error) func(context.Context, []K.Message) error {
+	return func(ctx context.Context, messages []K.Message) error {
+		topicName := ""
+		for i, m := range messages {
+			if i > 0 && m.Topic != topicName {
+				topicName = ""
+				break
+			}
+			topicName = m.Topic
+		}
+
+		name := operationProcess
+		if topicName != "" {
+			name += " " + topicName
+		}
+		attrs := append(messageAttributes(topicName), messagingBatchCount.Int(len(messages)))
+		ctx, span := t.tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindConsumer), trace.WithAttributes(attrs...),
+			trace.WithLinks(t.links(messages...)...))
+		defer span.End()
+
+		return endSpan(span, handler(ctx, messages))
+	}
+}
+
+func (t *Tracer) startProducer(ctx context.Context, topicName string, partition int, message *K.ProducerMessage) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		messagingSystem.String(systemKafka),
+		messagingOperationType.String(operationPublish),
+		messagingDestination.String(topicName),
+	}
+	if message != nil {
+		attrs = append(attrs, messagingBatchCount.Int(len(message.Records)))
+	}
+	if partition >= 0 {
+		attrs = append(attrs, messagingPartition.String(strconv.Itoa(partition)))
+	}
+	return t.tracer.Start(ctx, operationPublish+" "+topicName,
+		trace.WithSpanKind(trace.SpanKindProducer), trace.WithAttributes(attrs...))
+}
+
+// inject returns a copy of message whose records carry the trace context of ctx.
+func (t *Tracer) inject(ctx context.Context, message *K.ProducerMessage) *K.ProducerMessage {
+	if message == nil {
+		return nil
+	}
+
+	m := *message
+	m.Records = make([]K.ProducerRecord, len(message.Records))
+	for i, r := range message.Records {
+		r.Headers = append([]K.Header(nil), r.Headers...)
+		t.Inject(ctx, &r)
+		m.Records[i] = r
+	}
+	return &m
+}
+
+// links returns the links to the valid producer span contexts of messages.
+func (t *Tracer) links(messages ...K.Message) []trace.Link {
+	var links []trace.Link
+	for _, m := range messages {
+		sc := trace.SpanContextFromContext(t.Extract(context.Background(), m))
+		if sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	return links
+}
+
+// endProducer records err and the errors of the records produced.
+func endProducer(span trace.Span, pr *K.ProducerResponse, err error) error {
+	if pr != nil {
+		failed := 0
+		for _, o := range pr.Offsets {
+			if o.ErrorCode != 0 {
+				failed++
+			}
+		}
+		if failed > 0 && err == nil {
+			span.SetStatus(codes.Error, strconv.Itoa(failed)+" records failed")
+		}
+	}
+	return endSpan(span, err)
+}
+
+func endSpan(span trace.Span, err error) error {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func endpointAttributes(e K.Endpoint) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if e.Topic != "" {
+		attrs = append(attrs, messagingDestination.String(e.Topic))
+	}
+	if e.Partition >= 0 {
+		attrs = append(attrs, messagingPartition.String(strconv.Itoa(e.Partition)))
+	}
+	if e.Group != "" {
+		attrs = append(attrs, messagingConsumerGroup.String(e.Group))
+	}
+	if e.Instance != "" {
+		attrs = append(attrs, messagingClientID.String(e.Instance))
+	}
+	return attrs
+}
+
+func messageAttributes(topicName string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		messagingSystem.String(systemKafka),
+		messagingOperationType.String(operationProcess),
+	}
+	if topicName != "" {
+		attrs = append(attrs, messagingDestination.String(topicName))
+	}
+	return attrs
+}
+
+// Get implements propagation.TextMapCarrier.
+func (c headerCarrier) Get(key string) string {
+	for _, h := range *c.headers {
+		if h.Name == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set implements propagation.TextMapCarrier, replacing the header named key if any.
+func (c headerCarrier) Set(key, value string) {
+	for i, h := range *c.headers {
+		if h.Name == key {
+			(*c.headers)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c.headers = append(*c.headers, K.Header{Name: key, Value: []byte(value)})
+}
+
+// Keys implements propagation.TextMapCarrier.
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Name)
+	}
+	return keys
+}
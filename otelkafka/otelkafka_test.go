@@ -0,0 +1,80 @@
+package otelkafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/andy2046/kafka-rest-go/kafkatest"
+	"github.com/andy2046/kafka-rest-go/otelkafka"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	s, _ := kafkatest.NewServer()
+	defer s.Close()
+	s.CreateTopic("t", 1)
+
+	recorder := tracetest.NewSpanRecorder()
+	tracer, err := otelkafka.New(otelkafka.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))))
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	k, _ := s.Client(K.V2Version, tracer.Instrument)
+
+	message := &K.ProducerMessage{Records: []K.ProducerRecord{{Value: json.RawMessage(`"a"`)}}}
+	if _, err := tracer.Produce(context.Background(), k.NewTopics(), "t", message); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	if len(message.Records[0].Headers) != 0 {
+		t.Errorf("Expected message not modified got %v", message.Records[0].Headers)
+	}
+
+	mc := k.NewConsumers("cg").NewManagedConsumer(K.ConsumerRequest{Format: K.Binary, Offset: K.Earliest})
+	mc.Topics = []string{"t"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	mc.Run(ctx, tracer.HandleMessages(func(_ context.Context, messages []K.Message) error {
+		cancel()
+		return nil
+	}))
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	publish, request := spans["publish t"], spans["POST /topics/{topic}"]
+	if publish == nil || request == nil || request.Parent().SpanID() != publish.SpanContext().SpanID() {
+		t.Fatalf("Expected produce request span child of publish span got %v", spans)
+	}
+	if !hasAttribute(request, attribute.String("messaging.destination.name", "t")) ||
+		!hasAttribute(request, attribute.Int("http.response.status_code", 200)) {
+		t.Errorf("Expected topic and status attributes got %v", request.Attributes())
+	}
+
+	records := spans["GET /consumers/{group}/instances/{instance}/records"]
+	if records == nil || !hasAttribute(records, attribute.String("messaging.consumer.group.name", "cg")) {
+		t.Errorf("Expected records request span with consumer group got %v", records)
+	}
+
+	process := spans["process t"]
+	if process == nil || process.SpanKind() != trace.SpanKindConsumer || len(process.Links()) != 1 ||
+		process.Links()[0].SpanContext.SpanID() != publish.SpanContext().SpanID() {
+		t.Fatalf("Expected process span linked to publish span got %v", process)
+	}
+}
+
+func hasAttribute(span sdktrace.ReadOnlySpan, kv attribute.KeyValue) bool {
+	for _, a := range span.Attributes() {
+		if a == kv {
+			return true
+		}
+	}
+	return false
+}
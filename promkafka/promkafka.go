@@ -0,0 +1,248 @@
+// Package promkafka exports the metrics of package kafka to Prometheus.
+//
+// Metrics implements kafka.Metrics, set on Kafka with kafka.SetMetrics, and prometheus.Collector, to be registered
+// with a prometheus.Registerer. The empty poll ratio is the rate of empty_polls_total over polls_total.
+package promkafka
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// Metrics collects the metrics of Kafka.
+	Metrics struct {
+		// Namespace prefixes the metric names, default to "kafka_rest"
+		Namespace string
+		// Buckets are the buckets of request and commit duration histograms, default to prometheus.DefBuckets
+		Buckets []float64
+
+		requestDuration *prometheus.HistogramVec
+		retries         *prometheus.CounterVec
+		producedRecords *prometheus.CounterVec
+		producedBytes   *prometheus.CounterVec
+		produceErrors   *prometheus.CounterVec
+		fetchedRecords  *prometheus.CounterVec
+		fetchedBytes    *prometheus.CounterVec
+		polls           *prometheus.CounterVec
+		emptyPolls      *prometheus.CounterVec
+		commitDuration  *prometheus.HistogramVec
+		partitionLag    *prometheus.GaugeVec
+		groupLag        *prometheus.GaugeVec
+		inFlight        *prometheus.GaugeVec
+		uncommitted     *prometheus.GaugeVec
+
+		mu sync.Mutex
+		// lagged are the partitions with a lag series per group, deleted once no longer reported
+		lagged map[string]map[lagPartition]bool
+	}
+
+	lagPartition struct {
+		topic     string
+		partition string
+	}
+)
+
+const (
+	defaultNamespace = "kafka_rest"
+
+	statusOK    = "ok"
+	statusError = "error"
+)
+
+// New returns a Metrics instance, options are applied in order before the metrics are created.
+func New(options ...func(*Metrics) error) (*Metrics, error) {
+	m := &Metrics{
+		Namespace: defaultNamespace,
+		Buckets:   prometheus.DefBuckets,
+		lagged:    make(map[string]map[lagPartition]bool),
+	}
+	for _, opt := range options {
+		if err := opt(m); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.Buckets) == 0 {
+		return nil, errors.New("Error: empty Buckets")
+	}
+
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{Namespace: m.Namespace, Name: name, Help: help}, labels)
+	}
+	gauge := func(name, help string, labels ...string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{Namespace: m.Namespace, Name: name, Help: help}, labels)
+	}
+	histogram := func(name, help string, labels ...string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: m.Namespace, Name: name, Help: help, Buckets: m.Buckets,
+		}, labels)
+	}
+
+	m.requestDuration = histogram("request_duration_seconds", "Duration of REST proxy requests until the response headers.", "endpoint", "status")
+	m.retries = counter("retries_total", "Operations retried after a failure.", "operation")
+	m.producedRecords = counter("produced_records_total", "Records produced successfully.", "topic")
+	m.producedBytes = counter("produced_bytes_total", "Bytes of keys and values of records produced successfully.", "topic")
+	m.produceErrors = counter("produce_errors_total", "Records which failed to be produced, by error code.", "topic", "error_code")
+	m.fetchedRecords = counter("fetched_records_total", "Records fetched by consumers.", "group")
+	m.fetchedBytes = counter("fetched_bytes_total", "Bytes of keys and values of records fetched by consumers.", "group")
+	m.polls = counter("polls_total", "Successful fetches by consumers.", "group")
+	m.emptyPolls = counter("empty_polls_total", "Successful fetches by consumers which returned no records.", "group")
+	m.commitDuration = histogram("commit_duration_seconds", "Duration of offset commits.", "group", "status")
+	m.partitionLag = gauge("consumer_partition_lag", "Lag of consumer groups per partition.", "group", "topic", "partition")
+	m.groupLag = gauge("consumer_lag", "Total lag of consumer groups.", "group")
+	m.inFlight = gauge("in_flight_messages", "Messages of the current batch of managed consumers being handled.", "group")
+	m.uncommitted = gauge("uncommitted_messages", "Messages tracked by offset trackers and not yet committable.", "group")
+
+	return m, nil
+}
+
+// SetNamespace applies Namespace to Metrics.
+func SetNamespace(namespace string) func(*Metrics) error {
+	return func(m *Metrics) error {
+		m.Namespace = namespace
+		return nil
+	}
+}
+
+// SetBuckets applies Buckets to Metrics.
+func SetBuckets(buckets ...float64) func(*Metrics) error {
+	return func(m *Metrics) error {
+		m.Buckets = buckets
+		return nil
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.requestDuration, m.retries,
+		m.producedRecords, m.producedBytes, m.produceErrors,
+		m.fetchedRecords, m.fetchedBytes, m.polls, m.emptyPolls,
+		m.commitDuration, m.partitionLag, m.groupLag, m.inFlight, m.uncommitted,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// Request implements kafka.Metrics, the status is "error" if the request failed without response.
+func (m *Metrics) Request(e K.Endpoint, statusCode int, duration time.Duration) {
+	status := statusError
+	if statusCode > 0 {
+		status = strconv.Itoa(statusCode)
+	}
+	m.requestDuration.WithLabelValues(e.Name, status).Observe(duration.Seconds())
+}
+
+// Retry implements kafka.Metrics.
+func (m *Metrics) Retry(operation string) {
+	m.retries.WithLabelValues(operation).Inc()
+}
+
+// Produced implements kafka.Metrics. The error code of a failed request is the one of the API error,
+// its status code if none, or "error" if it failed without response, e.g. on timeout.
+func (m *Metrics) Produced(topic string, message *K.ProducerMessage, pr *K.ProducerResponse, err error) {
+	if pr == nil {
+		code := statusError
+		if apiErr, ok := errors.Cause(err).(*K.APIError); ok && apiErr.ErrorCode != 0 {
+			code = strconv.Itoa(apiErr.ErrorCode)
+		} else if ok {
+			code = strconv.Itoa(apiErr.StatusCode)
+		}
+		records := 0
+		if message != nil {
+			records = len(message.Records)
+		}
+		m.produceErrors.WithLabelValues(topic, code).Add(float64(records))
+		return
+	}
+
+	records, bytes := 0, 0
+	for i, o := range pr.Offsets {
+		if o.ErrorCode != 0 {
+			m.produceErrors.WithLabelValues(topic, strconv.FormatInt(o.ErrorCode, 10)).Inc()
+			continue
+		}
+		records++
+		if message != nil && i < len(message.Records) {
+			bytes += len(message.Records[i].Key) + len(message.Records[i].Value)
+		}
+	}
+	m.producedRecords.WithLabelValues(topic).Add(float64(records))
+	m.producedBytes.WithLabelValues(topic).Add(float64(bytes))
+}
+
+// Fetched implements kafka.Metrics, failed fetches are measured by Request only.
+func (m *Metrics) Fetched(group string, messages []K.Message, err error) {
+	if err != nil {
+		return
+	}
+
+	m.polls.WithLabelValues(group).Inc()
+	if len(messages) == 0 {
+		m.emptyPolls.WithLabelValues(group).Inc()
+		return
+	}
+
+	bytes := 0
+	for _, msg := range messages {
+		bytes += len(msg.Key) + len(msg.Value)
+	}
+	m.fetchedRecords.WithLabelValues(group).Add(float64(len(messages)))
+	m.fetchedBytes.WithLabelValues(group).Add(float64(bytes))
+}
+
+// Committed implements kafka.Metrics.
+func (m *Metrics) Committed(group string, duration time.Duration, err error) {
+	status := statusOK
+	if err != nil {
+		status = statusError
+	}
+	m.commitDuration.WithLabelValues(group, status).Observe(duration.Seconds())
+}
+
+// Lag implements kafka.Metrics. The lag of partitions no longer reported for the group, e.g. revoked, is deleted.
+func (m *Metrics) Lag(group string, lag *K.ConsumerLag) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reported := make(map[lagPartition]bool, len(lag.Partitions))
+	for _, pl := range lag.Partitions {
+		lp := lagPartition{topic: pl.Topic, partition: strconv.Itoa(pl.Partition)}
+		reported[lp] = true
+		m.partitionLag.WithLabelValues(group, lp.topic, lp.partition).Set(float64(pl.Lag))
+	}
+	for lp := range m.lagged[group] {
+		if !reported[lp] {
+			m.partitionLag.DeleteLabelValues(group, lp.topic, lp.partition)
+		}
+	}
+	m.lagged[group] = reported
+
+	m.groupLag.WithLabelValues(group).Set(float64(lag.Total))
+}
+
+// InFlight implements kafka.Metrics.
+func (m *Metrics) InFlight(group string, messages int) {
+	m.inFlight.WithLabelValues(group).Set(float64(messages))
+}
+
+// Uncommitted implements kafka.Metrics.
+func (m *Metrics) Uncommitted(group string, messages int) {
+	m.uncommitted.WithLabelValues(group).Set(float64(messages))
+}
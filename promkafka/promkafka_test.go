@@ -0,0 +1,105 @@
+package promkafka_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	K "github.com/andy2046/kafka-rest-go/kafka"
+	"github.com/andy2046/kafka-rest-go/kafkatest"
+	"github.com/andy2046/kafka-rest-go/promkafka"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	s, _ := kafkatest.NewServer()
+	defer s.Close()
+	s.CreateTopic("t", 1)
+	s.Inject(&kafkatest.Fault{Endpoint: "POST /topics/{topic}", Times: 1, FailRecords: []int{1}})
+
+	m, err := promkafka.New()
+	if err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(m); err != nil {
+		t.Fatalf("Expected no error got %v", err)
+	}
+	k, _ := s.Client(K.V2Version, K.SetMetrics(m))
+
+	message := &K.ProducerMessage{Records: []K.ProducerRecord{{Value: json.RawMessage(`"a"`)}, {Value: json.RawMessage(`"b"`)}}}
+	k.NewTopics().Produce("t", message)
+
+	mc := k.NewConsumers("cg").NewManagedConsumer(K.ConsumerRequest{Format: K.Binary, Offset: K.Earliest})
+	mc.Topics = []string{"t"}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	mc.Run(ctx, func(context.Context, []K.Message) error {
+		cancel()
+		return nil
+	})
+
+	expected := `
+# HELP kafka_rest_fetched_records_total Records fetched by consumers.
+# TYPE kafka_rest_fetched_records_total counter
+kafka_rest_fetched_records_total{group="cg"} 1
+# HELP kafka_rest_produce_errors_total Records which failed to be produced, by error code.
+# TYPE kafka_rest_produce_errors_total counter
+kafka_rest_produce_errors_total{error_code="2",topic="t"} 1
+# HELP kafka_rest_produced_bytes_total Bytes of keys and values of records produced successfully.
+# TYPE kafka_rest_produced_bytes_total counter
+kafka_rest_produced_bytes_total{topic="t"} 3
+# HELP kafka_rest_produced_records_total Records produced successfully.
+# TYPE kafka_rest_produced_records_total counter
+kafka_rest_produced_records_total{topic="t"} 1
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"kafka_rest_fetched_records_total", "kafka_rest_produce_errors_total",
+		"kafka_rest_produced_bytes_total", "kafka_rest_produced_records_total")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n := testutil.CollectAndCount(m, "kafka_rest_request_duration_seconds"); n < 5 {
+		t.Errorf("Expected request durations of produce and consumer endpoints got %d", n)
+	}
+	if n := testutil.CollectAndCount(m, "kafka_rest_commit_duration_seconds"); n != 1 {
+		t.Errorf("Expected commit duration got %d", n)
+	}
+}
+
+func TestMetricsGauges(t *testing.T) {
+	m, _ := promkafka.New()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(m)
+
+	// partition 1 is revoked between the samples, its series is deleted
+	m.Lag("cg", &K.ConsumerLag{Partitions: []K.PartitionLag{{Topic: "t", Partition: 0, Lag: 3}, {Topic: "t", Partition: 1, Lag: 4}}, Total: 7})
+	m.Lag("cg", &K.ConsumerLag{Partitions: []K.PartitionLag{{Topic: "t", Partition: 0, Lag: 2}}, Total: 2})
+	m.Lag("other", &K.ConsumerLag{Partitions: []K.PartitionLag{{Topic: "t", Partition: 1, Lag: 1}}, Total: 1})
+
+	// the batch of ManagedConsumer and the messages tracked by OffsetTracker do not overwrite each other
+	m.InFlight("cg", 10)
+	m.Uncommitted("cg", 4)
+
+	expected := `
+# HELP kafka_rest_consumer_partition_lag Lag of consumer groups per partition.
+# TYPE kafka_rest_consumer_partition_lag gauge
+kafka_rest_consumer_partition_lag{group="cg",partition="0",topic="t"} 2
+kafka_rest_consumer_partition_lag{group="other",partition="1",topic="t"} 1
+# HELP kafka_rest_in_flight_messages Messages of the current batch of managed consumers being handled.
+# TYPE kafka_rest_in_flight_messages gauge
+kafka_rest_in_flight_messages{group="cg"} 10
+# HELP kafka_rest_uncommitted_messages Messages tracked by offset trackers and not yet committable.
+# TYPE kafka_rest_uncommitted_messages gauge
+kafka_rest_uncommitted_messages{group="cg"} 4
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"kafka_rest_consumer_partition_lag", "kafka_rest_in_flight_messages", "kafka_rest_uncommitted_messages")
+	if err != nil {
+		t.Error(err)
+	}
+}
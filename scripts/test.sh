@@ -2,8 +2,7 @@
 
 set -euo pipefail
 
-cd kafka
-go fmt
-go vet
-golint
-GOCACHE=off go test -v -race
+go fmt ./...
+go vet ./...
+golint ./...
+go test -v -race -count=1 ./...